@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jxskiss/gopkg/v2/zlog"
+	"github.com/jxskiss/mcli"
+)
+
+// runAuthzServer runs a tiny HTTP authorization server, which can be
+// used as a local stand-in of the "ext_authz" service for testing.
+//
+// A request is allowed if it carries "Authorization: Bearer <token>"
+// with one of the configured tokens, the user of the token is sent back
+// to Envoy in the "x-auth-user" header. Tokens are given as "user:token",
+// a token without user is assigned the user "user<N>", N being its
+// position in the list.
+func runAuthzServer(ctx *mcli.Context) {
+	var args struct {
+		Addr   string   `cli:"-a, --addr, address to listen on" default:"127.0.0.1:9191"`
+		Tokens []string `cli:"-t, --token, allowed bearer tokens as user:token, default \"test:test-token\""`
+	}
+	ctx.Parse(&args)
+	if len(args.Tokens) == 0 {
+		args.Tokens = []string{"test:test-token"}
+	}
+
+	users := make(map[string]string, len(args.Tokens))
+	for i, t := range args.Tokens {
+		user, token, ok := strings.Cut(t, ":")
+		if !ok {
+			user, token = fmt.Sprintf("user%d", i+1), t
+		}
+		users[token] = user
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		user, ok := users[token]
+		if !ok || token == "" {
+			zlog.Infof("authz: deny %s %s", r.Method, r.URL.Path)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		zlog.Infof("authz: allow %s %s, user %s", r.Method, r.URL.Path, user)
+		w.Header().Set("x-auth-user", user)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	zlog.Infof("authz server listening on %s", args.Addr)
+	err := http.ListenAndServe(args.Addr, handler)
+	if err != nil {
+		zlog.Fatalf("failed run authz server: %v", err)
+	}
+}
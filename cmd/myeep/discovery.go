@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jxskiss/gopkg/v2/zlog"
+	"github.com/jxskiss/mcli"
+
+	"github.com/jxskiss/myeep/pkg/envoy"
+)
+
+func runDiscovery(ctx *mcli.Context) {
+	var args struct {
+		ConfDir string `cli:"-c, --conf-dir, configuration directory" default:"./conf"`
+		Once    bool   `cli:"    --once, resolve endpoints once and exit"`
+	}
+	ctx.Parse(&args)
+	cfg := readConfigOrExit(args.ConfDir)
+
+	discovery, err := envoy.NewDiscovery(cfg)
+	if err != nil {
+		zlog.Fatalf("failed create discovery: %v", err)
+	}
+	failed := discovery.RunOnce(context.Background())
+	if args.Once {
+		if failed > 0 {
+			zlog.Fatalf("failed update %d clusters", failed)
+		}
+		zlog.Infof("success")
+		return
+	}
+	discovery.Run(context.Background())
+}
+
+// runRegistryServer runs a tiny Consul-compatible registry server, which
+// can be used as a local stand-in of the "consul" discovery source for
+// testing. It serves "/v1/health/service/<service>" from a registry file
+// in the same format as the "file" discovery source, the file is read
+// on every request.
+func runRegistryServer(ctx *mcli.Context) {
+	var args struct {
+		Addr string `cli:"-a, --addr, address to listen on" default:"127.0.0.1:8500"`
+		File string `cli:"#R, file, registry file, a mapping from service name to list of endpoints"`
+	}
+	ctx.Parse(&args)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		service := strings.TrimPrefix(r.URL.Path, "/v1/health/service/")
+		if service == r.URL.Path || service == "" {
+			http.NotFound(w, r)
+			return
+		}
+		endpoints, err := readRegistryFile(args.File, service)
+		if err != nil {
+			zlog.Warnf("registry: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(endpoints)
+	})
+
+	zlog.Infof("registry server listening on %s", args.Addr)
+	err := http.ListenAndServe(args.Addr, handler)
+	if err != nil {
+		zlog.Fatalf("failed run registry server: %v", err)
+	}
+}
+
+func readRegistryFile(file, service string) ([]any, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := envoy.ParseRegistryFile(data, service)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]any, 0, len(endpoints))
+	for _, ep := range endpoints {
+		host, port, err := splitHostPort(ep.Address)
+		if err != nil {
+			return nil, err
+		}
+		entry := map[string]any{
+			"Node": map[string]any{"Address": host},
+			"Service": map[string]any{
+				"Service": service,
+				"Address": host,
+				"Port":    port,
+			},
+			"Checks": []any{
+				map[string]any{"Status": "passing"},
+			},
+		}
+		if ep.Weight > 0 {
+			entry["Service"].(map[string]any)["Weights"] = map[string]any{"Passing": ep.Weight}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func splitHostPort(address string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port in address %q", address)
+	}
+	return host, port, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jxskiss/gopkg/v2/zlog"
+	"github.com/jxskiss/mcli"
+
+	"github.com/jxskiss/myeep/pkg/envoy"
+)
+
+func listEndpoints(ctx *mcli.Context) {
+	var args struct {
+		ConfDir string `cli:"-c, --conf-dir, configuration directory" default:"./conf"`
+		Cluster string `cli:"#R, cluster, name of the EDS cluster"`
+	}
+	ctx.Parse(&args)
+	cfg := readConfigOrExit(args.ConfDir)
+
+	endpoints, err := envoy.ListEndpoints(cfg, args.Cluster)
+	if err != nil {
+		zlog.Fatalf("failed list endpoints: %v", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDRESS\tWEIGHT\tSTATUS")
+	for _, ep := range endpoints {
+		status := "ACTIVE"
+		if ep.Draining {
+			status = "DRAINING"
+		}
+		weight := "-"
+		if ep.Weight > 0 {
+			weight = fmt.Sprint(ep.Weight)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", ep.Address, weight, status)
+	}
+	w.Flush()
+}
+
+func addEndpoint(ctx *mcli.Context) {
+	var args struct {
+		ConfDir string `cli:"-c, --conf-dir, configuration directory" default:"./conf"`
+		Cluster string `cli:"#R, cluster, name of the EDS cluster"`
+		Address string `cli:"#R, address, endpoint address, e.g. 10.0.0.1:8080"`
+		Weight  int    `cli:"-w, --weight, load balancing weight, the weight of an existing endpoint is kept if not set"`
+	}
+	fs, _ := ctx.Parse(&args)
+	cfg := readConfigOrExit(args.ConfDir)
+
+	var weight *int
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "w" || f.Name == "weight" {
+			weight = &args.Weight
+		}
+	})
+	err := envoy.AddEndpoint(cfg, args.Cluster, args.Address, weight)
+	if err != nil {
+		zlog.Fatalf("failed add endpoint: %v", err)
+	}
+	zlog.Infof("success")
+}
+
+func removeEndpoint(ctx *mcli.Context) {
+	var args struct {
+		ConfDir string `cli:"-c, --conf-dir, configuration directory" default:"./conf"`
+		Cluster string `cli:"#R, cluster, name of the EDS cluster"`
+		Address string `cli:"#R, address, endpoint address"`
+	}
+	ctx.Parse(&args)
+	cfg := readConfigOrExit(args.ConfDir)
+
+	err := envoy.RemoveEndpoint(cfg, args.Cluster, args.Address)
+	if err != nil {
+		zlog.Fatalf("failed remove endpoint: %v", err)
+	}
+	zlog.Infof("success")
+}
+
+func drainEndpoint(ctx *mcli.Context) {
+	var args struct {
+		ConfDir string `cli:"-c, --conf-dir, configuration directory" default:"./conf"`
+		Cluster string `cli:"#R, cluster, name of the EDS cluster"`
+		Address string `cli:"#R, address, endpoint address"`
+	}
+	ctx.Parse(&args)
+	cfg := readConfigOrExit(args.ConfDir)
+
+	err := envoy.DrainEndpoint(cfg, args.Cluster, args.Address)
+	if err != nil {
+		zlog.Fatalf("failed drain endpoint: %v", err)
+	}
+	zlog.Infof("success")
+}
+
+func setEndpointWeight(ctx *mcli.Context) {
+	var args struct {
+		ConfDir string `cli:"-c, --conf-dir, configuration directory" default:"./conf"`
+		Cluster string `cli:"#R, cluster, name of the EDS cluster"`
+		Address string `cli:"#R, address, endpoint address"`
+		Weight  int    `cli:"#R, weight, load balancing weight"`
+	}
+	ctx.Parse(&args)
+	cfg := readConfigOrExit(args.ConfDir)
+
+	err := envoy.SetEndpointWeight(cfg, args.Cluster, args.Address, args.Weight)
+	if err != nil {
+		zlog.Fatalf("failed set endpoint weight: %v", err)
+	}
+	zlog.Infof("success")
+}
+
+func readConfigOrExit(confDir string) *envoy.Configuration {
+	cfg, err := envoy.ReadConfig(confDir)
+	if err != nil {
+		zlog.Fatalf("failed read config: %v", err)
+	}
+	return cfg
+}
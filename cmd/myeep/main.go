@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,6 +27,16 @@ func main() {
 	app.Add("envoy hot-restarter", runHotRestarter, "(WIP) Run envoy hot-restarter")
 	app.Add("envoy generate-config", generateEnvoyConfig, "Generate envoy config files")
 	app.Add("envoy dump", dumpEnvoyConfig, "Dump envoy configuration from admin interface")
+	app.Add("envoy traffic shift", shiftTraffic, "Rewrite weights of a weighted route and regenerate config files")
+	app.Add("envoy endpoints list", listEndpoints, "List endpoints of an EDS cluster")
+	app.Add("envoy endpoints add", addEndpoint, "Add an endpoint to an EDS cluster")
+	app.Add("envoy endpoints remove", removeEndpoint, "Remove an endpoint from an EDS cluster")
+	app.Add("envoy endpoints drain", drainEndpoint, "Drain an endpoint of an EDS cluster")
+	app.Add("envoy endpoints set-weight", setEndpointWeight, "Set load balancing weight of an endpoint")
+	app.Add("envoy discovery", runDiscovery, "Resolve endpoints of EDS clusters from discovery sources")
+	app.Add("envoy registry-server", runRegistryServer, "Run a stand-in Consul-compatible registry server for testing")
+	app.Add("envoy authz-server", runAuthzServer, "Run a stand-in ext_authz server for testing")
+	app.Add("envoy trace-collector", runTraceCollector, "Run a stand-in Zipkin trace collector for testing")
 	app.Run()
 }
 
@@ -90,6 +101,34 @@ func generateEnvoyConfig(ctx *mcli.Context) {
 	zlog.Infof("success")
 }
 
+func shiftTraffic(ctx *mcli.Context) {
+	var args struct {
+		ConfDir string   `cli:"-c, --conf-dir, configuration directory" default:"./conf"`
+		Route   string   `cli:"#R, route, name of the weighted route"`
+		Weights []string `cli:"#R, weights, cluster weights in format <cluster>=<weight>, which must sum to 100"`
+	}
+	ctx.Parse(&args)
+	cfg, err := envoy.ReadConfig(args.ConfDir)
+	if err != nil {
+		zlog.Fatalf("failed read config: %v", err)
+	}
+
+	weights := make(map[string]int, len(args.Weights))
+	for _, x := range args.Weights {
+		cluster, weightStr, ok := strings.Cut(x, "=")
+		weight, err := strconv.Atoi(weightStr)
+		if !ok || cluster == "" || err != nil {
+			zlog.Fatalf("invalid weight %q, want <cluster>=<weight>", x)
+		}
+		weights[cluster] = weight
+	}
+	err = envoy.ShiftTraffic(cfg, args.Route, weights)
+	if err != nil {
+		zlog.Fatalf("failed shift traffic: %v", err)
+	}
+	zlog.Infof("success")
+}
+
 func dumpEnvoyConfig(ctx *mcli.Context) {
 	var args struct {
 		ConfDir      string `cli:"-c, --conf-dir, configuration directory" default:"./conf"`
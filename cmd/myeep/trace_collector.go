@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jxskiss/gopkg/v2/zlog"
+	"github.com/jxskiss/mcli"
+)
+
+type zipkinSpan struct {
+	TraceId       string            `json:"traceId"`
+	Id            string            `json:"id"`
+	Name          string            `json:"name"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint map[string]any    `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags"`
+}
+
+// runTraceCollector runs a tiny Zipkin-compatible collector, which can
+// be used as a local stand-in of the tracing collector for testing.
+// It accepts spans in the Zipkin v2 JSON format and logs them.
+func runTraceCollector(ctx *mcli.Context) {
+	var args struct {
+		Addr string `cli:"-a, --addr, address to listen on" default:"127.0.0.1:9411"`
+		Path string `cli:"-p, --path, path of the collector endpoint" default:"/api/v2/spans"`
+	}
+	ctx.Parse(&args)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(args.Path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var spans []zipkinSpan
+		if err := json.NewDecoder(r.Body).Decode(&spans); err != nil {
+			zlog.Warnf("trace collector: invalid spans: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, s := range spans {
+			zlog.Infof("trace collector: trace=%s span=%s name=%q duration=%dus service=%v tags=%v",
+				s.TraceId, s.Id, s.Name, s.Duration, s.LocalEndpoint["serviceName"], s.Tags)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	zlog.Infof("trace collector listening on %s%s", args.Addr, args.Path)
+	err := http.ListenAndServe(args.Addr, mux)
+	if err != nil {
+		zlog.Fatalf("failed run trace collector: %v", err)
+	}
+}
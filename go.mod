@@ -7,7 +7,6 @@ require (
 	github.com/jxskiss/gopkg/v2 v2.8.3
 	github.com/jxskiss/mcli v0.7.0
 	github.com/lorenzosaino/go-sysctl v0.3.2-0.20230409170338-f1dde0a7a485
-	github.com/spf13/cast v1.5.0
 	go.uber.org/zap v1.24.0
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,131 @@
+package envoy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// namedPorts are well-known port names which can be used in place of
+// port numbers, e.g. "0.0.0.0:https".
+var namedPorts = map[string]int{
+	"http":  80,
+	"https": 443,
+	"dns":   53,
+	"smtp":  25,
+	"imap":  143,
+	"imaps": 993,
+	"mysql": 3306,
+	"redis": 6379,
+}
+
+// parsedAddress is the result of parsing an address string.
+//
+// An address is in one of the following formats:
+//   - "unix:/path/to/socket" for unix domain socket
+//   - "unix:@name" for unix domain socket in the abstract namespace
+//   - "ip:port", IPv6 addresses must be bracketed, e.g. "[::1]:443"
+//   - "hostname:port", which is only valid in DNS clusters
+//   - "udp://ip:port" for UDP listeners, "tcp://" is also accepted
+//
+// The port can be either a number or a well-known name, e.g. "https".
+type parsedAddress struct {
+	Pipe       string
+	Protocol   string
+	Host       string
+	Port       int
+	IsHostname bool
+}
+
+func (a *parsedAddress) IsPipe() bool { return a.Pipe != "" }
+
+func (a *parsedAddress) IsAbstract() bool { return strings.HasPrefix(a.Pipe, "@") }
+
+func parseAddress(s string) (*parsedAddress, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("empty address")
+	}
+
+	// Check unix domain socket.
+	if strings.HasPrefix(s, "unix:") {
+		pipePath := s[5:]
+		if pipePath == "" || pipePath == "@" {
+			return nil, fmt.Errorf("invalid unix socket address %q: missing path", s)
+		}
+		return &parsedAddress{Pipe: pipePath}, nil
+	}
+
+	var protocol string
+	hostPort := s
+	if i := strings.Index(s, "://"); i > 0 {
+		switch scheme := strings.ToLower(s[:i]); scheme {
+		case "tcp", "udp":
+			protocol = strings.ToUpper(scheme)
+		default:
+			return nil, fmt.Errorf("invalid address %q: unsupported scheme %q", s, scheme)
+		}
+		hostPort = s[i+3:]
+	}
+
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", s, err)
+	}
+	if host == "" {
+		return nil, fmt.Errorf("invalid address %q: missing host", s)
+	}
+	port, err := parsePort(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", s, err)
+	}
+
+	addr := &parsedAddress{Protocol: protocol, Host: host, Port: port}
+	if net.ParseIP(host) == nil {
+		if !isValidHostname(host) {
+			return nil, fmt.Errorf("invalid address %q: %q is neither an IP nor a valid hostname", s, host)
+		}
+		addr.IsHostname = true
+	}
+	return addr, nil
+}
+
+func parsePort(s string) (int, error) {
+	if s == "" {
+		return 0, fmt.Errorf("missing port")
+	}
+	if port, ok := namedPorts[strings.ToLower(s)]; ok {
+		return port, nil
+	}
+	port, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("unknown port name %q", s)
+	}
+	if port < 0 || port > 65535 {
+		return 0, fmt.Errorf("port %d out of range", port)
+	}
+	return port, nil
+}
+
+func isValidHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+			if !isAlnum && c != '-' && c != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package envoy
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	testCases := []struct {
+		input   string
+		want    *parsedAddress
+		wantErr bool
+	}{
+		{input: "127.0.0.1:8080", want: &parsedAddress{Host: "127.0.0.1", Port: 8080}},
+		{input: " 0.0.0.0:80 ", want: &parsedAddress{Host: "0.0.0.0", Port: 80}},
+		{input: "[::]:443", want: &parsedAddress{Host: "::", Port: 443}},
+		{input: "[::1]:8080", want: &parsedAddress{Host: "::1", Port: 8080}},
+		{input: "0.0.0.0:https", want: &parsedAddress{Host: "0.0.0.0", Port: 443}},
+		{input: "127.0.0.1:HTTP", want: &parsedAddress{Host: "127.0.0.1", Port: 80}},
+		{input: "10.0.0.1:redis", want: &parsedAddress{Host: "10.0.0.1", Port: 6379}},
+		{input: "api.example.com:443", want: &parsedAddress{Host: "api.example.com", Port: 443, IsHostname: true}},
+		{input: "_http._tcp.example.com.:80", want: &parsedAddress{Host: "_http._tcp.example.com.", Port: 80, IsHostname: true}},
+		{input: "udp://0.0.0.0:dns", want: &parsedAddress{Protocol: "UDP", Host: "0.0.0.0", Port: 53}},
+		{input: "UDP://[::]:443", want: &parsedAddress{Protocol: "UDP", Host: "::", Port: 443}},
+		{input: "tcp://127.0.0.1:0", want: &parsedAddress{Protocol: "TCP", Host: "127.0.0.1", Port: 0}},
+		{input: "unix:/var/run/envoy.sock", want: &parsedAddress{Pipe: "/var/run/envoy.sock"}},
+		{input: "unix:@envoy", want: &parsedAddress{Pipe: "@envoy"}},
+
+		{input: "", wantErr: true},
+		{input: "127.0.0.1", wantErr: true},
+		{input: "127.0.0.1:", wantErr: true},
+		{input: ":8080", wantErr: true},
+		{input: "::1:8080", wantErr: true},
+		{input: "[::1]", wantErr: true},
+		{input: "127.0.0.1:65536", wantErr: true},
+		{input: "127.0.0.1:-1", wantErr: true},
+		{input: "127.0.0.1:gopher", wantErr: true},
+		{input: "http://127.0.0.1:80", wantErr: true},
+		{input: "udp://", wantErr: true},
+		{input: "-bad-.example.com:80", wantErr: true},
+		{input: "bad..example.com:80", wantErr: true},
+		{input: "bad host:80", wantErr: true},
+		{input: "unix:", wantErr: true},
+		{input: "unix:@", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := parseAddress(tc.input)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseAddress(%q) got %+v, want error", tc.input, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseAddress(%q) got %+v, %v, want %+v", tc.input, got, err, tc.want)
+		}
+	}
+}
+
+func TestCmdAddress(t *testing.T) {
+	testCases := []struct {
+		name    string
+		arg     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "ip",
+			arg:  `"[::]:https"`,
+			want: `{address: {socket_address: {address: "::", port_value: 443}}}`,
+		},
+		{
+			name: "udp",
+			arg:  `"udp://0.0.0.0:443"`,
+			want: `{address: {socket_address: {address: 0.0.0.0, port_value: 443, protocol: UDP}}}`,
+		},
+		{
+			name: "pipe mode",
+			arg:  `{address: "unix:/run/envoy.sock", mode: 0660}`,
+			want: `{address: {pipe: {path: /run/envoy.sock, mode: 0660}}}`,
+		},
+		{
+			name: "hostname allowed",
+			arg:  `{address: "api.example.com:443", allow_hostname: true}`,
+			want: `{address: {socket_address: {address: api.example.com, port_value: 443}}}`,
+		},
+		{
+			name:    "hostname",
+			arg:     `"api.example.com:443"`,
+			wantErr: true,
+		},
+		{
+			name:    "mode of abstract socket",
+			arg:     `{address: "unix:@envoy", mode: 0660}`,
+			wantErr: true,
+		},
+		{
+			name:    "mode of ip",
+			arg:     `{address: "127.0.0.1:80", mode: 0660}`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &YAMLParser{cfg: &Configuration{}}
+			got, err := p.cmdAddress(mustParseYAML(t, tc.arg))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("cmdAddress want error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cmdAddress: %v", err)
+			}
+			// Compare the printed values, as the pipe mode is uint32.
+			want := mustParseYAML(t, tc.want)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("cmdAddress got %v, want %v", got, want)
+			}
+		})
+	}
+}
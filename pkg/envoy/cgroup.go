@@ -0,0 +1,120 @@
+package envoy
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	cgroupRoot         = "/sys/fs/cgroup"
+	procSelfCgroupFile = "/proc/self/cgroup"
+)
+
+// cgroupV1UnlimitedMemory is a threshold of the cgroup v1 memory limit,
+// larger values mean that memory is not limited, the kernel reports
+// a page-aligned MaxInt64 in that case.
+const cgroupV1UnlimitedMemory = 1 << 62
+
+// detectMemoryLimit returns the memory limit of the cgroup which the
+// current process belongs to, both cgroup v1 and v2 are supported.
+// It returns 0 if memory is not limited or cgroup is not available.
+func detectMemoryLimit() (uint64, error) {
+	return cgroupMemoryLimit(cgroupRoot, procSelfCgroupFile)
+}
+
+// cgroupMemoryLimit returns the memory limit of the cgroup in procFile,
+// which is in the format of /proc/self/cgroup, under the cgroup
+// filesystem mounted at root.
+//
+// If the cgroup directory is not found under root, e.g. the container
+// has no cgroup namespace but the container's cgroup is mounted at root,
+// the limit at root is used.
+func cgroupMemoryLimit(root, procFile string) (uint64, error) {
+	// cgroup v2
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		path, _ := cgroupPath(procFile, "")
+		for _, dir := range uniquePaths(filepath.Join(root, path), root) {
+			limit, err := readCgroupValue(filepath.Join(dir, "memory.max"))
+			if err == nil || !os.IsNotExist(err) {
+				return limit, err
+			}
+		}
+		return 0, nil
+	}
+
+	// cgroup v1
+	path, _ := cgroupPath(procFile, "memory")
+	memoryRoot := filepath.Join(root, "memory")
+	for _, dir := range uniquePaths(filepath.Join(memoryRoot, path), memoryRoot) {
+		limit, err := readCgroupValue(filepath.Join(dir, "memory.limit_in_bytes"))
+		if err == nil || !os.IsNotExist(err) {
+			if limit >= cgroupV1UnlimitedMemory {
+				limit = 0
+			}
+			return limit, err
+		}
+	}
+	return 0, nil
+}
+
+// cgroupPath returns the cgroup path from procFile, which is in the
+// format of /proc/self/cgroup, controller is empty for the cgroup v2
+// hierarchy. The path is "/" inside a container which has its own
+// cgroup namespace.
+func cgroupPath(procFile, controller string) (string, error) {
+	data, err := os.ReadFile(procFile)
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if controller == "" {
+			if parts[0] == "0" && parts[1] == "" {
+				return parts[2], nil
+			}
+			continue
+		}
+		for _, c := range strings.Split(parts[1], ",") {
+			if c == controller {
+				return parts[2], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("cgroup %q not found", controller)
+}
+
+func readCgroupValue(file string) (uint64, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return 0, nil
+	}
+	x, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q in %s", s, file)
+	}
+	return x, nil
+}
+
+func uniquePaths(paths ...string) []string {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if len(out) == 0 || out[len(out)-1] != p {
+			out = append(out, p)
+		}
+	}
+	return out
+}
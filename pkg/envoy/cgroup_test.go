@@ -0,0 +1,189 @@
+package envoy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFixtureFiles writes files relative to dir, creating the parent
+// directories as needed.
+func writeFixtureFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCgroupMemoryLimit(t *testing.T) {
+	testCases := []struct {
+		name    string
+		proc    string
+		files   map[string]string
+		want    uint64
+		wantErr bool
+	}{
+		{
+			name: "v2 namespace root",
+			proc: "0::/\n",
+			files: map[string]string{
+				"cgroup.controllers": "cpu memory pids\n",
+				"memory.max":         "536870912\n",
+			},
+			want: 536870912,
+		},
+		{
+			name: "v2 max",
+			proc: "0::/\n",
+			files: map[string]string{
+				"cgroup.controllers": "cpu memory pids\n",
+				"memory.max":         "max\n",
+			},
+			want: 0,
+		},
+		{
+			name: "v2 nested cgroup",
+			proc: "0::/kubepods/pod1/container1\n",
+			files: map[string]string{
+				"cgroup.controllers":                  "cpu memory pids\n",
+				"memory.max":                          "max\n",
+				"kubepods/pod1/container1/memory.max": "1073741824\n",
+			},
+			want: 1073741824,
+		},
+		{
+			name: "v2 cgroup mounted at root",
+			proc: "0::/docker/abc\n",
+			files: map[string]string{
+				"cgroup.controllers": "cpu memory pids\n",
+				"memory.max":         "268435456\n",
+			},
+			want: 268435456,
+		},
+		{
+			name: "v2 invalid value",
+			proc: "0::/\n",
+			files: map[string]string{
+				"cgroup.controllers": "cpu memory pids\n",
+				"memory.max":         "lots\n",
+			},
+			wantErr: true,
+		},
+		{
+			name: "v1 namespace root unlimited",
+			proc: "5:cpu,cpuacct:/\n4:memory:/\n1:name=systemd:/\n",
+			files: map[string]string{
+				"memory/memory.limit_in_bytes": "9223372036854771712\n",
+			},
+			want: 0,
+		},
+		{
+			name: "v1 namespace root limited",
+			proc: "4:memory:/\n",
+			files: map[string]string{
+				"memory/memory.limit_in_bytes": "2147483648\n",
+			},
+			want: 2147483648,
+		},
+		{
+			name: "v1 nested cgroup",
+			proc: "6:pids:/docker/abc\n4:cpuacct,memory:/docker/abc\n",
+			files: map[string]string{
+				"memory/memory.limit_in_bytes":            "9223372036854771712\n",
+				"memory/docker/abc/memory.limit_in_bytes": "134217728\n",
+			},
+			want: 134217728,
+		},
+		{
+			name: "v1 cgroup mounted at root",
+			proc: "4:memory:/docker/abc\n",
+			files: map[string]string{
+				"memory/memory.limit_in_bytes": "134217728\n",
+			},
+			want: 134217728,
+		},
+		{
+			name:  "no cgroup",
+			proc:  "",
+			files: map[string]string{},
+			want:  0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			root := filepath.Join(dir, "sys/fs/cgroup")
+			procFile := filepath.Join(dir, "proc/self/cgroup")
+			writeFixtureFiles(t, root, tc.files)
+			writeFixtureFiles(t, dir, map[string]string{"proc/self/cgroup": tc.proc})
+
+			got, err := cgroupMemoryLimit(root, procFile)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("cgroupMemoryLimit got %d, want error", got)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Fatalf("cgroupMemoryLimit got %d, %v, want %d", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestCgroupPath(t *testing.T) {
+	dir := t.TempDir()
+	procFile := filepath.Join(dir, "cgroup")
+	writeFixtureFiles(t, dir, map[string]string{
+		"cgroup": "12:pids:/a\n4:cpuacct,memory:/b\n0::/c\n",
+	})
+	testCases := []struct {
+		controller string
+		want       string
+		wantErr    bool
+	}{
+		{controller: "", want: "/c"},
+		{controller: "memory", want: "/b"},
+		{controller: "pids", want: "/a"},
+		{controller: "cpu", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := cgroupPath(procFile, tc.controller)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("cgroupPath(%q) got %q, want error", tc.controller, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("cgroupPath(%q) got %q, %v, want %q", tc.controller, got, err, tc.want)
+		}
+	}
+}
+
+func TestReadCgroupValue(t *testing.T) {
+	dir := t.TempDir()
+	writeFixtureFiles(t, dir, map[string]string{
+		"max":     "max\n",
+		"number":  "1048576\n",
+		"invalid": "-1\n",
+	})
+	if x, err := readCgroupValue(filepath.Join(dir, "max")); err != nil || x != 0 {
+		t.Errorf("readCgroupValue(max) got %d, %v", x, err)
+	}
+	if x, err := readCgroupValue(filepath.Join(dir, "number")); err != nil || x != 1048576 {
+		t.Errorf("readCgroupValue(number) got %d, %v", x, err)
+	}
+	if _, err := readCgroupValue(filepath.Join(dir, "invalid")); err == nil {
+		t.Errorf("readCgroupValue(invalid) want error")
+	}
+	if _, err := readCgroupValue(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("readCgroupValue(missing) got %v, want not exist error", err)
+	}
+}
@@ -1,6 +1,7 @@
 package envoy
 
 import (
+	"os"
 	"path/filepath"
 
 	"github.com/jxskiss/errors"
@@ -15,11 +16,30 @@ type Configuration struct {
 	AdminPort   int    `yaml:"adminPort" env:"ENVOY_ADMIN_PORT" default:"9000"`
 	LogLevel    string `yaml:"logLevel" env:"ENVOY_LOG_LEVEL" flag:"log-level" default:"info"`
 
+	// NodeIdSuffix is appended to the hostname when NodeId is not
+	// specified, e.g. "-canary".
+	NodeIdSuffix string `yaml:"nodeIdSuffix" env:"ENVOY_NODE_ID_SUFFIX"`
+
+	// NodeMetadata and Locality are rendered into the bootstrap node,
+	// they are also available to templates, e.g. "{{ .Locality.Zone }}".
+	NodeMetadata map[string]any `yaml:"nodeMetadata"`
+	Locality     struct {
+		Region  string `yaml:"region" env:"ENVOY_LOCALITY_REGION"`
+		Zone    string `yaml:"zone" env:"ENVOY_LOCALITY_ZONE"`
+		SubZone string `yaml:"subZone" env:"ENVOY_LOCALITY_SUB_ZONE"`
+	} `yaml:"locality"`
+
 	MaxOpenFilesNum      uint64 `yaml:"maxOpenFilesNum" env:"ENVOY_MAX_OPEN_FILES" default:"102400"`
 	MaxInotifyWatchesNum uint64 `yaml:"maxInotifyWatchesNum" env:"ENVOY_MAX_INOTIFY_WATCHES" default:"524288"`
 
 	PassThroughFlags []string `yaml:"passThroughFlags"`
 
+	// BootstrapMode tells how to use the optional bootstrap.yaml template
+	// in the configuration directory, "merge" deep-merges it into the
+	// built-in bootstrap config, list entries with the same name, e.g.
+	// static clusters, are merged into one, "replace" uses it instead.
+	BootstrapMode string `yaml:"bootstrapMode" env:"ENVOY_BOOTSTRAP_MODE" default:"merge"`
+
 	SimpleSSL struct {
 		Enable      bool   `yaml:"enable"`
 		ClusterName string `yaml:"clusterName"`
@@ -30,6 +50,90 @@ type Configuration struct {
 		ClientKey   string `yaml:"clientKey"`
 	} `yaml:"simpleSSL"`
 
+	SDS struct {
+		// DefaultProvider is used by the "sds_tls" command when the
+		// secret reference does not specify a provider.
+		DefaultProvider string         `yaml:"defaultProvider"`
+		Providers       []*SDSProvider `yaml:"providers"`
+	} `yaml:"sds"`
+
+	// RDS emits the route configurations of HTTP connection managers to
+	// separate files which are loaded by file-based RDS, thus route
+	// changes apply without draining listeners.
+	RDS bool `yaml:"rds" env:"ENVOY_RDS"`
+
+	Discovery struct {
+		// Interval is the interval to resolve endpoints, default 10s.
+		Interval string             `yaml:"interval" default:"10s"`
+		Clusters []*DiscoveryConfig `yaml:"clusters"`
+	} `yaml:"discovery"`
+
+	// Overload configures the overload manager, which is sized from the
+	// cgroup memory limit detected when generating the bootstrap config,
+	// see cmdOverloadManager.
+	Overload struct {
+		Disable bool `yaml:"disable" env:"ENVOY_OVERLOAD_DISABLE"`
+
+		// MemoryLimit overrides the detected memory limit, e.g. "2Gi".
+		MemoryLimit string `yaml:"memoryLimit" env:"ENVOY_OVERLOAD_MEMORY_LIMIT"`
+
+		HeapPercent                    int     `yaml:"heapPercent" default:"80"`
+		ShrinkHeapThreshold            float64 `yaml:"shrinkHeapThreshold" default:"0.95"`
+		StopAcceptingRequestsThreshold float64 `yaml:"stopAcceptingRequestsThreshold" default:"0.98"`
+		MaxDownstreamConnections       uint64  `yaml:"maxDownstreamConnections"`
+	} `yaml:"overload"`
+
+	Stats struct {
+		Sinks []*StatsSink `yaml:"sinks"`
+		Tags  []*StatsTag  `yaml:"tags"`
+
+		// UseAllDefaultTags enables Envoy's default tag extraction, which
+		// is enabled by Envoy if not specified.
+		UseAllDefaultTags *bool `yaml:"useAllDefaultTags"`
+
+		// Inclusions and Exclusions are patterns of stat names to keep
+		// or drop, only one of them can be specified,
+		// see statsMatcherPatterns for the pattern format.
+		Inclusions []string `yaml:"inclusions"`
+		Exclusions []string `yaml:"exclusions"`
+	} `yaml:"stats"`
+
+	Tracing struct {
+		// Provider is either "opentelemetry" or "zipkin", tracing is
+		// disabled if it is empty.
+		Provider string `yaml:"provider" env:"ENVOY_TRACING_PROVIDER"`
+
+		// Address is the collector address, e.g. "127.0.0.1:4317" of an
+		// OpenTelemetry collector (gRPC), or "127.0.0.1:9411" of Zipkin.
+		Address string `yaml:"address" env:"ENVOY_TRACING_ADDRESS"`
+
+		// ServiceName is the service name of spans, default is
+		// nodeCluster. It is only supported by OpenTelemetry, Envoy's
+		// zipkin tracer always reports nodeCluster as the service name,
+		// thus it is rejected for zipkin.
+		ServiceName string `yaml:"serviceName"`
+
+		// SamplingRate is the percentage of sampled requests, Envoy
+		// samples all requests if it is not specified.
+		SamplingRate *float64      `yaml:"samplingRate"`
+		Tags         []*TracingTag `yaml:"tags"`
+
+		// ZipkinPath is the collector endpoint, default "/api/v2/spans".
+		ZipkinPath string `yaml:"zipkinPath"`
+	} `yaml:"tracing"`
+
+	AccessLog struct {
+		// LogDir is the directory to place access log files which
+		// are specified by relative path.
+		LogDir string `yaml:"logDir" env:"ENVOY_ACCESS_LOG_DIR" default:"./logs"`
+
+		// Default is the default access log applied to listeners which
+		// don't specify access logs, it accepts the same options as
+		// the "access_log" command. Network filters such as tcp_proxy
+		// use it with the "tcp_access_log" defaults.
+		Default map[string]any `yaml:"default"`
+	} `yaml:"accessLog"`
+
 	confDir string
 }
 
@@ -41,6 +145,13 @@ func ReadConfig(confDir string) (*Configuration, error) {
 		return nil, errors.WithMessage(err, "read envoy configuration")
 	}
 	cfg.confDir = confDir
+	if cfg.NodeId == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, errors.WithMessage(err, "get hostname as node id")
+		}
+		cfg.NodeId = hostname + cfg.NodeIdSuffix
+	}
 	zlog.Infof("envoy configuration: %v", easy.JSON(cfg))
 	return cfg, nil
 }
@@ -48,3 +159,15 @@ func ReadConfig(confDir string) (*Configuration, error) {
 func (cfg *Configuration) OutputPath() string {
 	return filepath.Join(cfg.confDir, "generated")
 }
+
+func (cfg *Configuration) RoutesPath() string {
+	return filepath.Join(cfg.OutputPath(), "routes")
+}
+
+func (cfg *Configuration) EndpointsPath() string {
+	return filepath.Join(cfg.OutputPath(), "endpoints")
+}
+
+func (cfg *Configuration) IncludesPath() string {
+	return filepath.Join(cfg.confDir, "includes")
+}
@@ -2,17 +2,26 @@ package envoy
 
 import (
 	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/jxskiss/errors"
 	"github.com/jxskiss/gopkg/v2/easy"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	bootstrapModeMerge   = "merge"
+	bootstrapModeReplace = "replace"
+)
+
 const bootstrapTpl = `
 "!@@ envoy_node": {}
 "!@@ envoy_admin": {}
+"!@@ envoy_stats": {}
+"!@@ overload_manager": {}
 
 dynamic_resources:
   lds_config:
@@ -38,9 +47,13 @@ func NewConfigGenerator(cfg *Configuration) *ConfigGenerator {
 
 type ConfigGenerator struct {
 	cfg *Configuration
+
+	useAdminCluster bool
+	accessLogDirs   []string
 }
 
 func (p *ConfigGenerator) Generate() error {
+	p.accessLogDirs = nil
 	if err := p.genBootstrapConfig(); err != nil {
 		return err
 	}
@@ -57,6 +70,21 @@ func (p *ConfigGenerator) BootstrapConfigFile() string {
 	return filepath.Join(p.cfg.OutputPath(), "bootstrap.yaml")
 }
 
+// AccessLogDirs returns the directories of file access logs in the
+// generated configuration, Envoy fails to start if they don't exist.
+func (p *ConfigGenerator) AccessLogDirs() []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, dir := range p.accessLogDirs {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
 func (p *ConfigGenerator) genBootstrapConfig() error {
 	parser := &YAMLParser{
 		cfg: p.cfg,
@@ -64,19 +92,112 @@ func (p *ConfigGenerator) genBootstrapConfig() error {
 
 	header := "# This file is auto generated, do not edit.\n\n"
 
-	yamlData, err := parser.parseYAML(bootstrapTpl, p.cfg)
+	custom, err := p.readCustomBootstrap(parser)
 	if err != nil {
-		return errors.WithMessage(err, "parse bootstrap yaml")
+		return err
 	}
-	yamlData, err = parser.solveCommands("bootstrap", yamlData)
-	if err != nil {
-		return errors.WithMessage(err, "solve commands in bootstrap yaml")
+
+	var yamlData any
+	if custom != nil && p.cfg.BootstrapMode == bootstrapModeReplace {
+		yamlData = custom
+	} else {
+		yamlData, err = parser.parseYAML(bootstrapTpl, p.cfg)
+		if err != nil {
+			return errors.WithMessage(err, "parse bootstrap yaml")
+		}
+		yamlData, err = parser.solveCommands("bootstrap", yamlData)
+		if err != nil {
+			return errors.WithMessage(err, "solve commands in bootstrap yaml")
+		}
+		if custom != nil {
+			mergeBootstrap(yamlData.(map[string]any), custom)
+		}
 	}
 
+	p.accessLogDirs = append(p.accessLogDirs, parser.accessLogDirs...)
 	outFile := p.BootstrapConfigFile()
 	return p.writeYaml(outFile, yamlData, header)
 }
 
+// mergeBootstrap merges the custom bootstrap.yaml into the generated
+// bootstrap config like mergeMap, except that list entries which have
+// the same "name" as an existing entry are merged into it instead of
+// appended, e.g. static clusters, since Envoy rejects duplicate names.
+func mergeBootstrap(dst, src map[string]any) {
+	for k, srcVal := range src {
+		switch x := srcVal.(type) {
+		case map[string]any:
+			if dstMap, ok := dst[k].(map[string]any); ok {
+				mergeBootstrap(dstMap, x)
+				continue
+			}
+		case []any:
+			if dstSlice, ok := dst[k].([]any); ok {
+				dst[k] = mergeNamedList(dstSlice, x)
+				continue
+			}
+		}
+		dst[k] = srcVal
+	}
+}
+
+func mergeNamedList(dst, src []any) []any {
+	for _, srcElem := range src {
+		srcMap, _ := srcElem.(map[string]any)
+		if name, ok := srcMap["name"].(string); ok {
+			if i := indexOfNamed(dst, name); i >= 0 {
+				mergeBootstrap(dst[i].(map[string]any), srcMap)
+				continue
+			}
+		}
+		dst = append(dst, srcElem)
+	}
+	return dst
+}
+
+func indexOfNamed(list []any, name string) int {
+	for i, x := range list {
+		if m, ok := x.(map[string]any); ok && m["name"] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// readCustomBootstrap reads the optional bootstrap.yaml template in the
+// configuration directory, it returns nil if the file does not exist.
+func (p *ConfigGenerator) readCustomBootstrap(parser *YAMLParser) (map[string]any, error) {
+	switch p.cfg.BootstrapMode {
+	case "", bootstrapModeMerge, bootstrapModeReplace:
+	default:
+		return nil, fmt.Errorf("unsupported bootstrapMode %q", p.cfg.BootstrapMode)
+	}
+	tmplFile := filepath.Join(p.cfg.confDir, "bootstrap.yaml")
+	yamlText, err := os.ReadFile(tmplFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithMessage(err, "read bootstrap.yaml")
+	}
+	yamlData, err := parser.parseYAML(string(yamlText), p.cfg)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse bootstrap.yaml")
+	}
+	yamlData, err = parser.solveCommands("bootstrap", yamlData)
+	if err != nil {
+		return nil, errors.WithMessage(err, "solve commands in bootstrap.yaml")
+	}
+	if yamlData == nil {
+		return nil, nil
+	}
+	custom, ok := yamlData.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("bootstrap.yaml must be a mapping")
+	}
+	return custom, nil
+}
+
 func (p *ConfigGenerator) genListenersConfig() error {
 	parser := &YAMLParser{
 		cfg: p.cfg,
@@ -97,11 +218,53 @@ func (p *ConfigGenerator) genListenersConfig() error {
 	if err != nil {
 		return errors.WithMessage(err, "solve commands in listeners.yaml")
 	}
+	p.useAdminCluster = parser.useAdminCluster
+	p.accessLogDirs = append(p.accessLogDirs, parser.accessLogDirs...)
+	orderListenerFilters(yamlData)
+	yamlData, err = addHTTP3Listeners(yamlData)
+	if err != nil {
+		return errors.WithMessage(err, "add HTTP/3 listeners")
+	}
 
+	if p.cfg.RDS {
+		if err = p.genRoutesConfig(yamlData); err != nil {
+			return err
+		}
+	}
 	outFile := filepath.Join(p.cfg.OutputPath(), "listeners.yaml")
 	return p.writeYaml(outFile, yamlData, header)
 }
 
+// genRoutesConfig moves route configurations out of listeners, and
+// writes them to the routes directory, stale files are removed.
+// The route files must be written before listeners which reference them.
+func (p *ConfigGenerator) genRoutesConfig(listeners any) error {
+	header := "# This file is auto generated, do not edit.\n\nresources:\n\n"
+	routesDir := p.cfg.RoutesPath()
+	routeConfigs, err := extractRouteConfigs(listeners, routesDir)
+	if err != nil {
+		return errors.WithMessage(err, "extract route configurations")
+	}
+	generated := make(map[string]bool, len(routeConfigs))
+	for _, name := range sortedRouteConfigNames(routeConfigs) {
+		outFile := filepath.Join(routesDir, name+".yaml")
+		err = p.writeYaml(outFile, []any{routeConfigs[name]}, header)
+		if err != nil {
+			return err
+		}
+		generated[outFile] = true
+	}
+	staleFiles, _ := filepath.Glob(filepath.Join(routesDir, "*.yaml"))
+	for _, file := range staleFiles {
+		if !generated[file] {
+			if err = os.Remove(file); err != nil {
+				return errors.WithMessagef(err, "remove stale route file %s", file)
+			}
+		}
+	}
+	return nil
+}
+
 var simpleSSLClusterTpl = []byte(`
 # simplessl
 - "!@@ simple_cluster":
@@ -117,27 +280,51 @@ func (p *ConfigGenerator) genClustersConfig() error {
 
 	header := "# This file is auto generated, do not edit.\n\nresources:\n\n"
 
+	yamlData, err := p.solveClustersConfig(parser)
+	if err != nil {
+		return err
+	}
+	if err = writeEDSSeeds(p.cfg, parser.edsSeeds); err != nil {
+		return errors.WithMessage(err, "write EDS endpoints files")
+	}
+	p.accessLogDirs = append(p.accessLogDirs, parser.accessLogDirs...)
+
+	outFile := filepath.Join(p.cfg.OutputPath(), "clusters.yaml")
+	return p.writeYaml(outFile, yamlData, header)
+}
+
+// solveClustersConfig reads clusters.yaml and solves commands in it,
+// together with the clusters which are added automatically.
+func (p *ConfigGenerator) solveClustersConfig(parser *YAMLParser) (any, error) {
 	tmplFile := filepath.Join(p.cfg.confDir, "clusters.yaml")
 	yamlText, err := os.ReadFile(tmplFile)
 	if err != nil {
-		return errors.WithMessage(err, "read clusters.yaml")
+		return nil, errors.WithMessage(err, "read clusters.yaml")
 	}
 
 	if p.cfg.SimpleSSL.Enable {
 		yamlText = append(simpleSSLClusterTpl, yamlText...)
 	}
+	if p.cfg.tracingEnabled() {
+		tracingCluster, err := p.cfg.tracingClusterYAML()
+		if err != nil {
+			return nil, err
+		}
+		yamlText = append(tracingCluster, yamlText...)
+	}
+	if p.useAdminCluster {
+		yamlText = append(adminClusterTpl, yamlText...)
+	}
 
 	yamlData, err := parser.parseYAML(string(yamlText), p.cfg)
 	if err != nil {
-		return errors.WithMessage(err, "parse clusters.yaml")
+		return nil, errors.WithMessage(err, "parse clusters.yaml")
 	}
 	yamlData, err = parser.solveCommands("clusters", yamlData)
 	if err != nil {
-		return errors.WithMessage(err, "solve commands in clusters.yaml")
+		return nil, errors.WithMessage(err, "solve commands in clusters.yaml")
 	}
-
-	outFile := filepath.Join(p.cfg.OutputPath(), "clusters.yaml")
-	return p.writeYaml(outFile, yamlData, header)
+	return yamlData, nil
 }
 
 func (p *ConfigGenerator) writeYaml(file string, data any, header string) error {
@@ -151,9 +338,29 @@ func (p *ConfigGenerator) writeYaml(file string, data any, header string) error
 		return errors.WithMessagef(err, "encoding yaml file %s", file)
 	}
 
-	err = easy.WriteFile(file, buf.Bytes(), 0644)
+	// Envoy watches configuration files for move events, the file is
+	// written to a temporary file then renamed, and is left untouched
+	// if the content does not change.
+	if old, err := os.ReadFile(file); err == nil && bytes.Equal(old, buf.Bytes()) {
+		return nil
+	}
+	err = writeFileAtomic(file, buf.Bytes(), 0644)
 	if err != nil {
 		return errors.WithMessagef(err, "writing yaml file %s", file)
 	}
 	return nil
 }
+
+// writeFileAtomic writes data to a temporary file in the same directory,
+// then renames it to file.
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	tmpFile := file + ".tmp"
+	if err := easy.WriteFile(tmpFile, data, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, file); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package envoy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setupConfDir writes the configuration files into a temporary
+// configuration directory.
+func setupConfDir(t *testing.T, files map[string]string) *Configuration {
+	t.Helper()
+	dir := t.TempDir()
+	writeFixtureFiles(t, dir, files)
+	cfg := &Configuration{
+		NodeCluster: "test",
+		NodeId:      "test",
+		AdminPort:   9000,
+		confDir:     dir,
+	}
+	cfg.Overload.Disable = true
+	return cfg
+}
+
+func TestGenerateAccessLogDirs(t *testing.T) {
+	cfg := setupConfDir(t, map[string]string{
+		"clusters.yaml": `[]`,
+		"listeners.yaml": `
+- name: listener_http
+  "!@@ address": "127.0.0.1:10080"
+  filter_chains:
+    - filters:
+        - "!@@ hcm":
+            stat_prefix: ingress_http
+            access_log:
+              - "!@@ access_log": { sink: file }
+              - "!@@ access_log": { sink: file, path: sub/access.log }
+              - "!@@ access_log": { sink: file, path: /var/log/envoy/access.log }
+              - "!@@ access_log": { sink: stdout }
+            virtual_hosts:
+              - { name: default, domains: ["*"], routes: [] }
+- name: listener_tcp
+  "!@@ address": "127.0.0.1:10081"
+  filter_chains:
+    - filters:
+        - "!@@ tcp_proxy":
+            cluster: backend
+            access_log:
+              - "!@@ access_log": { sink: file, path: tcp.log }
+`,
+	})
+	cfg.AccessLog.LogDir = "/tmp/logs"
+
+	gen := NewConfigGenerator(cfg)
+	if err := gen.Generate(); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	want := []string{"/tmp/logs", filepath.Join("/tmp/logs", "sub"), "/var/log/envoy"}
+	if got := gen.AccessLogDirs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AccessLogDirs got %v, want %v", got, want)
+	}
+}
+
+func TestGenerateCustomBootstrap(t *testing.T) {
+	testCases := []struct {
+		name         string
+		mode         string
+		bootstrap    string
+		wantClusters []string
+		check        func(t *testing.T, bootstrap map[string]any)
+	}{
+		{
+			name:         "no custom bootstrap",
+			wantClusters: []string{"sds_vault"},
+		},
+		{
+			name: "merge sds_cluster command",
+			bootstrap: `
+static_resources:
+  clusters:
+    - "!@@ sds_cluster"
+    - { name: extra, type: STATIC }
+`,
+			wantClusters: []string{"sds_vault", "extra"},
+		},
+		{
+			name: "merge static cluster with built-in name",
+			bootstrap: `
+static_resources:
+  clusters:
+    - { name: sds_vault, connect_timeout: 5s }
+`,
+			wantClusters: []string{"sds_vault"},
+			check: func(t *testing.T, bootstrap map[string]any) {
+				cluster := bootstrap["static_resources"].(map[string]any)["clusters"].([]any)[0].(map[string]any)
+				if cluster["connect_timeout"] != "5s" || cluster["load_assignment"] == nil {
+					t.Errorf("cluster sds_vault is not merged: %v", cluster)
+				}
+			},
+		},
+		{
+			name: "merge keeps other maps and lists",
+			bootstrap: `
+admin:
+  profile_path: /tmp/envoy.prof
+layered_runtime:
+  layers:
+    - { name: static_layer, static_layer: {} }
+`,
+			wantClusters: []string{"sds_vault"},
+			check: func(t *testing.T, bootstrap map[string]any) {
+				admin := bootstrap["admin"].(map[string]any)
+				if admin["profile_path"] != "/tmp/envoy.prof" || admin["address"] == nil {
+					t.Errorf("admin is not merged: %v", admin)
+				}
+				if bootstrap["layered_runtime"] == nil {
+					t.Errorf("layered_runtime is not added")
+				}
+			},
+		},
+		{
+			name: "replace",
+			mode: "replace",
+			bootstrap: `
+static_resources:
+  clusters:
+    - "!@@ sds_cluster"
+    - { name: extra, type: STATIC }
+`,
+			wantClusters: []string{"sds_vault", "extra"},
+			check: func(t *testing.T, bootstrap map[string]any) {
+				if bootstrap["admin"] != nil || bootstrap["dynamic_resources"] != nil {
+					t.Errorf("built-in bootstrap is not replaced: %v", bootstrap)
+				}
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			files := map[string]string{}
+			if tc.bootstrap != "" {
+				files["bootstrap.yaml"] = tc.bootstrap
+			}
+			cfg := setupConfDir(t, files)
+			cfg.BootstrapMode = tc.mode
+			cfg.SDS.Providers = []*SDSProvider{{Name: "vault", Address: "10.0.0.5:8443"}}
+
+			gen := NewConfigGenerator(cfg)
+			if err := gen.genBootstrapConfig(); err != nil {
+				t.Fatalf("genBootstrapConfig: %v", err)
+			}
+			data, err := os.ReadFile(gen.BootstrapConfigFile())
+			if err != nil {
+				t.Fatal(err)
+			}
+			bootstrap := mustParseYAML(t, string(data)).(map[string]any)
+			var names []string
+			clusters := bootstrap["static_resources"].(map[string]any)["clusters"].([]any)
+			for _, c := range clusters {
+				names = append(names, c.(map[string]any)["name"].(string))
+			}
+			if !reflect.DeepEqual(names, tc.wantClusters) {
+				t.Errorf("static clusters got %v, want %v", names, tc.wantClusters)
+			}
+			if tc.check != nil {
+				tc.check(t, bootstrap)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package envoy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jxskiss/errors"
+	"github.com/jxskiss/gopkg/v2/zlog"
+)
+
+// DiscoveryConfig configures the service discovery of an EDS cluster.
+type DiscoveryConfig struct {
+	// Cluster is the name of an EDS cluster, see the "simple_cluster"
+	// command.
+	Cluster string `yaml:"cluster"`
+
+	// Source is the name of a registered DiscoverySource,
+	// builtin sources are "file", "dns_srv" and "consul".
+	Source string `yaml:"source"`
+
+	// File is a JSON or YAML file, used by the "file" source.
+	File string `yaml:"file"`
+
+	// SRV is the DNS SRV record name, used by the "dns_srv" source,
+	// e.g. "_http._tcp.api.service.consul".
+	SRV string `yaml:"srv"`
+
+	// URL, Datacenter and Token are used by the "consul" source.
+	URL        string `yaml:"url"`
+	Datacenter string `yaml:"datacenter"`
+	Token      string `yaml:"token"`
+
+	// Service is the service name in the registry, it defaults to
+	// the cluster name. Tag filters the services by tag.
+	Service string `yaml:"service"`
+	Tag     string `yaml:"tag"`
+
+	// IncludeUnhealthy includes the endpoints which don't pass health
+	// checks in the registry.
+	IncludeUnhealthy bool `yaml:"unhealthy"`
+}
+
+// DiscoverySource resolves the endpoints of a cluster.
+type DiscoverySource interface {
+	Resolve(ctx context.Context) ([]Endpoint, error)
+}
+
+// DiscoverySourceFactory creates a DiscoverySource by config.
+type DiscoverySourceFactory func(config *DiscoveryConfig) (DiscoverySource, error)
+
+var (
+	discoverySourcesMu sync.RWMutex
+	discoverySources   = map[string]DiscoverySourceFactory{
+		"file":    newFileDiscoverySource,
+		"dns_srv": newDNSSRVDiscoverySource,
+		"consul":  newConsulDiscoverySource,
+	}
+)
+
+// RegisterDiscoverySource registers a DiscoverySource which can be used
+// by name in the discovery configuration.
+func RegisterDiscoverySource(name string, factory DiscoverySourceFactory) {
+	discoverySourcesMu.Lock()
+	defer discoverySourcesMu.Unlock()
+	discoverySources[name] = factory
+}
+
+func getDiscoverySourceFactory(name string) DiscoverySourceFactory {
+	discoverySourcesMu.RLock()
+	defer discoverySourcesMu.RUnlock()
+	return discoverySources[name]
+}
+
+// Discovery periodically resolves endpoints of clusters from discovery
+// sources, and writes the endpoints to the EDS files.
+type Discovery struct {
+	cfg      *Configuration
+	interval time.Duration
+	clusters []*discoveryCluster
+}
+
+type discoveryCluster struct {
+	config *DiscoveryConfig
+	source DiscoverySource
+}
+
+func NewDiscovery(cfg *Configuration) (*Discovery, error) {
+	interval := 10 * time.Second
+	if cfg.Discovery.Interval != "" {
+		x, err := time.ParseDuration(cfg.Discovery.Interval)
+		if err != nil || x <= 0 {
+			return nil, fmt.Errorf("invalid discovery interval %q", cfg.Discovery.Interval)
+		}
+		interval = x
+	}
+	d := &Discovery{
+		cfg:      cfg,
+		interval: interval,
+	}
+	for _, config := range cfg.Discovery.Clusters {
+		if config.Cluster == "" {
+			return nil, fmt.Errorf("discovery: cluster is required")
+		}
+		if config.Service == "" {
+			config.Service = config.Cluster
+		}
+		factory := getDiscoverySourceFactory(config.Source)
+		if factory == nil {
+			return nil, fmt.Errorf("discovery %s: unknown source %q", config.Cluster, config.Source)
+		}
+		source, err := factory(config)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "discovery %s", config.Cluster)
+		}
+		d.clusters = append(d.clusters, &discoveryCluster{config: config, source: source})
+	}
+	return d, nil
+}
+
+// Run resolves endpoints every interval until ctx is done.
+// The first resolving happens after one interval, callers call RunOnce
+// before Run to resolve endpoints at startup.
+func (d *Discovery) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		d.RunOnce(ctx)
+	}
+}
+
+// RunOnce resolves endpoints of all clusters once, it returns the number
+// of clusters which failed.
+//
+// If a source fails or returns no endpoints, the endpoints of the
+// cluster are left untouched, to avoid dropping all traffic when the
+// registry is temporarily unavailable.
+func (d *Discovery) RunOnce(ctx context.Context) (failed int) {
+	for _, c := range d.clusters {
+		if err := d.resolveCluster(ctx, c); err != nil {
+			zlog.Warnf("discovery: failed update cluster %s: %v", c.config.Cluster, err)
+			failed++
+		}
+	}
+	return failed
+}
+
+func (d *Discovery) resolveCluster(ctx context.Context, c *discoveryCluster) error {
+	ctx, cancel := context.WithTimeout(ctx, d.interval)
+	defer cancel()
+	endpoints, err := c.source.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if len(endpoints) == 0 {
+		return fmt.Errorf("no endpoints resolved")
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Address < endpoints[j].Address
+	})
+	return UpdateEndpoints(d.cfg, c.config.Cluster, func(current []Endpoint) ([]Endpoint, error) {
+		// Keep endpoints draining which are drained by the
+		// "envoy endpoints drain" command.
+		draining := make(map[string]bool)
+		for _, ep := range current {
+			if ep.Draining {
+				draining[ep.Address] = true
+			}
+		}
+		for i := range endpoints {
+			endpoints[i].Draining = draining[endpoints[i].Address]
+		}
+		return endpoints, nil
+	})
+}
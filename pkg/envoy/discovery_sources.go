@@ -0,0 +1,208 @@
+package envoy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileDiscoverySource reads endpoints from a JSON or YAML file, which
+// is either a list of endpoints, or a mapping from service name to list
+// of endpoints. An endpoint is an address string, or a mapping with
+// "address" and "weight".
+type fileDiscoverySource struct {
+	file    string
+	service string
+}
+
+func newFileDiscoverySource(config *DiscoveryConfig) (DiscoverySource, error) {
+	if config.File == "" {
+		return nil, fmt.Errorf("file is required")
+	}
+	return &fileDiscoverySource{file: config.File, service: config.Service}, nil
+}
+
+func (s *fileDiscoverySource) Resolve(ctx context.Context) ([]Endpoint, error) {
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRegistryFile(data, s.service)
+}
+
+// ParseRegistryFile parses a registry file and returns the endpoints
+// of service, see fileDiscoverySource for the file format.
+func ParseRegistryFile(data []byte, service string) ([]Endpoint, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+	var list []clusterEndpoint
+	switch node := root.Content[0]; node.Kind {
+	case yaml.SequenceNode:
+		if err := node.Decode(&list); err != nil {
+			return nil, err
+		}
+	case yaml.MappingNode:
+		var services map[string][]clusterEndpoint
+		if err := node.Decode(&services); err != nil {
+			return nil, err
+		}
+		list = services[service]
+	default:
+		return nil, fmt.Errorf("registry file must be a list or a mapping")
+	}
+
+	endpoints := make([]Endpoint, 0, len(list))
+	for _, ep := range list {
+		endpoints = append(endpoints, Endpoint{Address: ep.Address, Weight: ep.Weight})
+	}
+	return endpoints, nil
+}
+
+// dnsSRVDiscoverySource resolves endpoints from a DNS SRV record, the
+// targets are resolved to IP addresses. Only the records with the
+// highest priority (the lowest value) are used.
+type dnsSRVDiscoverySource struct {
+	name     string
+	resolver *net.Resolver
+}
+
+func newDNSSRVDiscoverySource(config *DiscoveryConfig) (DiscoverySource, error) {
+	if config.SRV == "" {
+		return nil, fmt.Errorf("srv is required")
+	}
+	return &dnsSRVDiscoverySource{name: config.SRV, resolver: net.DefaultResolver}, nil
+}
+
+func (s *dnsSRVDiscoverySource) Resolve(ctx context.Context) ([]Endpoint, error) {
+	_, records, err := s.resolver.LookupSRV(ctx, "", "", s.name)
+	if err != nil {
+		return nil, err
+	}
+	var endpoints []Endpoint
+	for _, srv := range records {
+		if srv.Priority != records[0].Priority {
+			// Records are sorted by priority.
+			break
+		}
+		ips, err := s.resolver.LookupIPAddr(ctx, srv.Target)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			endpoints = append(endpoints, Endpoint{
+				Address: net.JoinHostPort(ip.IP.String(), strconv.Itoa(int(srv.Port))),
+				Weight:  int(srv.Weight),
+			})
+		}
+	}
+	return endpoints, nil
+}
+
+// consulDiscoverySource resolves endpoints from the health API of
+// a Consul-compatible registry, i.e. "/v1/health/service/<service>".
+type consulDiscoverySource struct {
+	config *DiscoveryConfig
+	client *http.Client
+}
+
+func newConsulDiscoverySource(config *DiscoveryConfig) (DiscoverySource, error) {
+	if config.URL == "" {
+		config.URL = "http://127.0.0.1:8500"
+	}
+	if _, err := url.Parse(config.URL); err != nil {
+		return nil, fmt.Errorf("invalid url %q: %w", config.URL, err)
+	}
+	return &consulDiscoverySource{config: config, client: http.DefaultClient}, nil
+}
+
+type consulServiceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+		Weights struct {
+			Passing int `json:"Passing"`
+		} `json:"Weights"`
+	} `json:"Service"`
+	Checks []struct {
+		Status string `json:"Status"`
+	} `json:"Checks"`
+}
+
+func (e *consulServiceEntry) isPassing() bool {
+	for _, c := range e.Checks {
+		if c.Status != "passing" {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *consulDiscoverySource) Resolve(ctx context.Context) ([]Endpoint, error) {
+	params := url.Values{}
+	if !s.config.IncludeUnhealthy {
+		params.Set("passing", "true")
+	}
+	if s.config.Tag != "" {
+		params.Set("tag", s.config.Tag)
+	}
+	if s.config.Datacenter != "" {
+		params.Set("dc", s.config.Datacenter)
+	}
+	reqURL := strings.TrimSuffix(s.config.URL, "/") + "/v1/health/service/" +
+		url.PathEscape(s.config.Service) + "?" + params.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.Token != "" {
+		req.Header.Set("X-Consul-Token", s.config.Token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("registry responds status %d: %s", resp.StatusCode, body)
+	}
+
+	var entries []consulServiceEntry
+	if err = json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("decode registry response: %w", err)
+	}
+	endpoints := make([]Endpoint, 0, len(entries))
+	for _, e := range entries {
+		// Registries which don't support the "passing" parameter
+		// return all entries, filter them again by the checks.
+		if !s.config.IncludeUnhealthy && !e.isPassing() {
+			continue
+		}
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		endpoints = append(endpoints, Endpoint{
+			Address: net.JoinHostPort(host, strconv.Itoa(e.Service.Port)),
+			Weight:  e.Service.Weights.Passing,
+		})
+	}
+	return endpoints, nil
+}
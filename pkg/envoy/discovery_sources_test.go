@@ -0,0 +1,119 @@
+package envoy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const testConsulResponse = `[
+  {
+    "Node": {"Address": "10.0.0.1"},
+    "Service": {"Address": "10.0.1.1", "Port": 8080, "Weights": {"Passing": 3}},
+    "Checks": [{"Status": "passing"}, {"Status": "passing"}]
+  },
+  {
+    "Node": {"Address": "10.0.0.2"},
+    "Service": {"Address": "", "Port": 8080},
+    "Checks": [{"Status": "passing"}]
+  },
+  {
+    "Node": {"Address": "10.0.0.3"},
+    "Service": {"Address": "10.0.1.3", "Port": 8080, "Weights": {"Passing": 1}},
+    "Checks": [{"Status": "passing"}, {"Status": "critical"}]
+  },
+  {
+    "Node": {"Address": "10.0.0.4"},
+    "Service": {"Address": "10.0.1.4", "Port": 8080},
+    "Checks": [{"Status": "warning"}]
+  }
+]`
+
+func TestConsulDiscoverySource(t *testing.T) {
+	testCases := []struct {
+		name             string
+		includeUnhealthy bool
+		wantQuery        string
+		want             []Endpoint
+	}{
+		{
+			name:      "passing only",
+			wantQuery: "dc=dc1&passing=true&tag=prod",
+			want: []Endpoint{
+				{Address: "10.0.1.1:8080", Weight: 3},
+				{Address: "10.0.0.2:8080"},
+			},
+		},
+		{
+			name:             "include unhealthy",
+			includeUnhealthy: true,
+			wantQuery:        "dc=dc1&tag=prod",
+			want: []Endpoint{
+				{Address: "10.0.1.1:8080", Weight: 3},
+				{Address: "10.0.0.2:8080"},
+				{Address: "10.0.1.3:8080", Weight: 1},
+				{Address: "10.0.1.4:8080"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotPath, gotQuery, gotToken string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				gotQuery = r.URL.RawQuery
+				gotToken = r.Header.Get("X-Consul-Token")
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(testConsulResponse))
+			}))
+			defer server.Close()
+
+			source, err := newConsulDiscoverySource(&DiscoveryConfig{
+				Cluster:          "api",
+				Source:           "consul",
+				URL:              server.URL + "/",
+				Datacenter:       "dc1",
+				Token:            "secret",
+				Service:          "api",
+				Tag:              "prod",
+				IncludeUnhealthy: tc.includeUnhealthy,
+			})
+			if err != nil {
+				t.Fatalf("newConsulDiscoverySource: %v", err)
+			}
+			got, err := source.Resolve(context.Background())
+			if err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if gotPath != "/v1/health/service/api" {
+				t.Errorf("request path got %q", gotPath)
+			}
+			if gotQuery != tc.wantQuery {
+				t.Errorf("request query got %q, want %q", gotQuery, tc.wantQuery)
+			}
+			if gotToken != "secret" {
+				t.Errorf("request token got %q", gotToken)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("endpoints got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConsulDiscoverySourceError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no leader", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	source, err := newConsulDiscoverySource(&DiscoveryConfig{URL: server.URL, Service: "api"})
+	if err != nil {
+		t.Fatalf("newConsulDiscoverySource: %v", err)
+	}
+	if _, err = source.Resolve(context.Background()); err == nil {
+		t.Fatalf("want error for status 500")
+	}
+}
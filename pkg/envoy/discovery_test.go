@@ -0,0 +1,49 @@
+package envoy
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingDiscoverySource struct {
+	count *int32
+}
+
+func (s countingDiscoverySource) Resolve(ctx context.Context) ([]Endpoint, error) {
+	atomic.AddInt32(s.count, 1)
+	return nil, nil
+}
+
+func TestDiscoveryRunWaitsForFirstTick(t *testing.T) {
+	var count int32
+	RegisterDiscoverySource("test_counting", func(config *DiscoveryConfig) (DiscoverySource, error) {
+		return countingDiscoverySource{count: &count}, nil
+	})
+
+	cfg := &Configuration{}
+	cfg.Discovery.Interval = "50ms"
+	cfg.Discovery.Clusters = []*DiscoveryConfig{{Cluster: "api", Source: "test_counting"}}
+	discovery, err := NewDiscovery(cfg)
+	if err != nil {
+		t.Fatalf("NewDiscovery: %v", err)
+	}
+
+	if failed := discovery.RunOnce(context.Background()); failed != 1 {
+		t.Errorf("RunOnce got %d failed clusters, want 1", failed)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	discovery.Run(ctx)
+	if got := atomic.LoadInt32(&count); got != 1 {
+		t.Errorf("resolved %d times before the first tick, want 1", got)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 80*time.Millisecond)
+	defer cancel()
+	discovery.Run(ctx)
+	if got := atomic.LoadInt32(&count); got != 2 {
+		t.Errorf("resolved %d times after the first tick, want 2", got)
+	}
+}
@@ -0,0 +1,296 @@
+package envoy
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/jxskiss/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const clusterLoadAssignmentType = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+
+// Endpoint is an endpoint of an EDS cluster.
+type Endpoint struct {
+	Address  string
+	Weight   int
+	Draining bool
+}
+
+// edsFile is the file-based EDS response, which contains exactly one
+// ClusterLoadAssignment.
+type edsFile struct {
+	Resources []*clusterLoadAssignment `yaml:"resources"`
+}
+
+type clusterLoadAssignment struct {
+	Type        string                `yaml:"@type"`
+	ClusterName string                `yaml:"cluster_name"`
+	Endpoints   []localityLbEndpoints `yaml:"endpoints"`
+}
+
+type localityLbEndpoints struct {
+	LbEndpoints []lbEndpoint `yaml:"lb_endpoints"`
+}
+
+type lbEndpoint struct {
+	Endpoint struct {
+		Address edsAddress `yaml:"address"`
+	} `yaml:"endpoint"`
+	HealthStatus        string `yaml:"health_status,omitempty"`
+	LoadBalancingWeight int    `yaml:"load_balancing_weight,omitempty"`
+}
+
+type edsAddress struct {
+	SocketAddress *edsSocketAddress `yaml:"socket_address,omitempty"`
+	Pipe          *edsPipe          `yaml:"pipe,omitempty"`
+}
+
+type edsSocketAddress struct {
+	Address   string `yaml:"address"`
+	PortValue int    `yaml:"port_value"`
+}
+
+type edsPipe struct {
+	Path string `yaml:"path"`
+}
+
+func (a edsAddress) String() string {
+	if a.Pipe != nil {
+		return "unix:" + a.Pipe.Path
+	}
+	if a.SocketAddress != nil {
+		return net.JoinHostPort(a.SocketAddress.Address, strconv.Itoa(a.SocketAddress.PortValue))
+	}
+	return ""
+}
+
+// edsClusterConfig returns the eds_cluster_config of a cluster which
+// loads endpoints from the file "<endpointsDir>/<cluster>.yaml".
+func edsClusterConfig(endpointsDir, cluster string) map[string]any {
+	return map[string]any{
+		"service_name": cluster,
+		"eds_config": map[string]any{
+			"resource_api_version": "V3",
+			"path_config_source": map[string]any{
+				"path": filepath.Join(endpointsDir, cluster+".yaml"),
+			},
+		},
+	}
+}
+
+func edsFilePath(cfg *Configuration, cluster string) (string, error) {
+	if cluster == "" || strings.ContainsAny(cluster, `/\`) || strings.HasPrefix(cluster, ".") {
+		return "", fmt.Errorf("invalid cluster name %q", cluster)
+	}
+	return filepath.Join(cfg.EndpointsPath(), cluster+".yaml"), nil
+}
+
+// writeEDSSeeds writes the endpoints files of EDS clusters with the
+// endpoints in clusters.yaml, existing files are left untouched, since
+// they are managed by the "envoy endpoints" command.
+func writeEDSSeeds(cfg *Configuration, seeds map[string][]Endpoint) error {
+	for cluster, endpoints := range seeds {
+		file, err := edsFilePath(cfg, cluster)
+		if err != nil {
+			return err
+		}
+		if _, err = os.Stat(file); err == nil {
+			continue
+		}
+		if err = writeEDSFile(file, cluster, endpoints); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListEndpoints returns the endpoints of an EDS cluster.
+func ListEndpoints(cfg *Configuration, cluster string) ([]Endpoint, error) {
+	file, err := edsFilePath(cfg, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return readEDSFile(file)
+}
+
+// UpdateEndpoints reads the endpoints of an EDS cluster, calls update
+// to change them, then writes the result back to the endpoints file.
+//
+// The file is locked during the update, and is written atomically,
+// thus it is safe to be called concurrently by deploy scripts.
+func UpdateEndpoints(cfg *Configuration, cluster string, update func(endpoints []Endpoint) ([]Endpoint, error)) error {
+	file, err := edsFilePath(cfg, cluster)
+	if err != nil {
+		return err
+	}
+	lockFile, err := os.OpenFile(file+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return errors.WithMessage(err, "open lock file")
+	}
+	defer lockFile.Close()
+	if err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		return errors.WithMessage(err, "lock endpoints file")
+	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+
+	endpoints, err := readEDSFile(file)
+	if err != nil {
+		return err
+	}
+	newEndpoints, err := update(append([]Endpoint(nil), endpoints...))
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(newEndpoints, endpoints) {
+		return nil
+	}
+	endpoints = newEndpoints
+	for _, ep := range endpoints {
+		addr, err := parseAddress(ep.Address)
+		if err != nil {
+			return err
+		}
+		if addr.IsHostname {
+			return fmt.Errorf("endpoint %q: EDS cluster requires IP address", ep.Address)
+		}
+	}
+	return writeEDSFile(file, cluster, endpoints)
+}
+
+// AddEndpoint adds an endpoint to an EDS cluster. Re-adding an existing
+// endpoint activates it if it is draining, its weight is changed only
+// if weight is not nil.
+func AddEndpoint(cfg *Configuration, cluster, address string, weight *int) error {
+	return UpdateEndpoints(cfg, cluster, func(endpoints []Endpoint) ([]Endpoint, error) {
+		for i := range endpoints {
+			if endpoints[i].Address == address {
+				if weight != nil {
+					endpoints[i].Weight = *weight
+				}
+				endpoints[i].Draining = false
+				return endpoints, nil
+			}
+		}
+		ep := Endpoint{Address: address}
+		if weight != nil {
+			ep.Weight = *weight
+		}
+		return append(endpoints, ep), nil
+	})
+}
+
+// RemoveEndpoint removes an endpoint from an EDS cluster.
+func RemoveEndpoint(cfg *Configuration, cluster, address string) error {
+	return UpdateEndpoints(cfg, cluster, func(endpoints []Endpoint) ([]Endpoint, error) {
+		for i := range endpoints {
+			if endpoints[i].Address == address {
+				return append(endpoints[:i], endpoints[i+1:]...), nil
+			}
+		}
+		return nil, fmt.Errorf("endpoint %s not found", address)
+	})
+}
+
+// DrainEndpoint marks an endpoint of an EDS cluster as draining.
+func DrainEndpoint(cfg *Configuration, cluster, address string) error {
+	return updateEndpoint(cfg, cluster, address, func(ep *Endpoint) {
+		ep.Draining = true
+	})
+}
+
+// SetEndpointWeight sets the load balancing weight of an endpoint of
+// an EDS cluster, the weight must be positive.
+func SetEndpointWeight(cfg *Configuration, cluster, address string, weight int) error {
+	if weight <= 0 {
+		return fmt.Errorf("weight must be positive, use drain or remove to stop traffic")
+	}
+	return updateEndpoint(cfg, cluster, address, func(ep *Endpoint) {
+		ep.Weight = weight
+	})
+}
+
+func updateEndpoint(cfg *Configuration, cluster, address string, update func(ep *Endpoint)) error {
+	return UpdateEndpoints(cfg, cluster, func(endpoints []Endpoint) ([]Endpoint, error) {
+		for i := range endpoints {
+			if endpoints[i].Address == address {
+				update(&endpoints[i])
+				return endpoints, nil
+			}
+		}
+		return nil, fmt.Errorf("endpoint %s not found", address)
+	})
+}
+
+func readEDSFile(file string) ([]Endpoint, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("endpoints file %s does not exist, check the cluster type is eds and config is generated", file)
+		}
+		return nil, errors.WithMessage(err, "read endpoints file")
+	}
+	var eds edsFile
+	if err = yaml.Unmarshal(data, &eds); err != nil {
+		return nil, errors.WithMessagef(err, "parse endpoints file %s", file)
+	}
+	if len(eds.Resources) != 1 {
+		return nil, fmt.Errorf("endpoints file %s: want exactly one resource, got %d", file, len(eds.Resources))
+	}
+
+	var endpoints []Endpoint
+	for _, locality := range eds.Resources[0].Endpoints {
+		for _, lbEp := range locality.LbEndpoints {
+			endpoints = append(endpoints, Endpoint{
+				Address:  lbEp.Endpoint.Address.String(),
+				Weight:   lbEp.LoadBalancingWeight,
+				Draining: lbEp.HealthStatus == "DRAINING",
+			})
+		}
+	}
+	return endpoints, nil
+}
+
+func writeEDSFile(file, cluster string, endpoints []Endpoint) error {
+	cla := &clusterLoadAssignment{
+		Type:        clusterLoadAssignmentType,
+		ClusterName: cluster,
+		Endpoints:   []localityLbEndpoints{{LbEndpoints: []lbEndpoint{}}},
+	}
+	for _, ep := range endpoints {
+		addr, err := parseAddress(ep.Address)
+		if err != nil {
+			return err
+		}
+		var lbEp lbEndpoint
+		if addr.IsPipe() {
+			lbEp.Endpoint.Address.Pipe = &edsPipe{Path: addr.Pipe}
+		} else {
+			lbEp.Endpoint.Address.SocketAddress = &edsSocketAddress{Address: addr.Host, PortValue: addr.Port}
+		}
+		lbEp.LoadBalancingWeight = ep.Weight
+		if ep.Draining {
+			lbEp.HealthStatus = "DRAINING"
+		}
+		cla.Endpoints[0].LbEndpoints = append(cla.Endpoints[0].LbEndpoints, lbEp)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# This file is managed by \"envoy endpoints\" command.\n\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&edsFile{Resources: []*clusterLoadAssignment{cla}}); err != nil {
+		return errors.WithMessagef(err, "encoding endpoints file %s", file)
+	}
+	if err := writeFileAtomic(file, buf.Bytes(), 0644); err != nil {
+		return errors.WithMessagef(err, "writing endpoints file %s", file)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package envoy
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// setupEndpointsFile writes the endpoints file of cluster "api" into
+// a temporary configuration directory.
+func setupEndpointsFile(t *testing.T, endpoints []Endpoint) *Configuration {
+	t.Helper()
+	cfg := &Configuration{confDir: t.TempDir()}
+	if err := writeEDSSeeds(cfg, map[string][]Endpoint{"api": endpoints}); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func intPtr(x int) *int { return &x }
+
+func TestUpdateEndpointsCommands(t *testing.T) {
+	initial := []Endpoint{
+		{Address: "10.0.0.1:8080", Weight: 5},
+		{Address: "10.0.0.2:8080", Draining: true},
+		{Address: "10.0.0.3:8080", Weight: 2, Draining: true},
+	}
+	testCases := []struct {
+		name    string
+		update  func(cfg *Configuration) error
+		want    []Endpoint
+		wantErr bool
+	}{
+		{
+			name: "add new endpoint",
+			update: func(cfg *Configuration) error {
+				return AddEndpoint(cfg, "api", "10.0.0.4:8080", intPtr(3))
+			},
+			want: append(append([]Endpoint(nil), initial...), Endpoint{Address: "10.0.0.4:8080", Weight: 3}),
+		},
+		{
+			name: "add new endpoint without weight",
+			update: func(cfg *Configuration) error {
+				return AddEndpoint(cfg, "api", "[::1]:8080", nil)
+			},
+			want: append(append([]Endpoint(nil), initial...), Endpoint{Address: "[::1]:8080"}),
+		},
+		{
+			name: "add existing endpoint keeps weight",
+			update: func(cfg *Configuration) error {
+				return AddEndpoint(cfg, "api", "10.0.0.3:8080", nil)
+			},
+			want: []Endpoint{initial[0], initial[1], {Address: "10.0.0.3:8080", Weight: 2}},
+		},
+		{
+			name: "add existing endpoint with weight",
+			update: func(cfg *Configuration) error {
+				return AddEndpoint(cfg, "api", "10.0.0.1:8080", intPtr(8))
+			},
+			want: []Endpoint{{Address: "10.0.0.1:8080", Weight: 8}, initial[1], initial[2]},
+		},
+		{
+			name: "add hostname",
+			update: func(cfg *Configuration) error {
+				return AddEndpoint(cfg, "api", "api.example.com:8080", nil)
+			},
+			wantErr: true,
+		},
+		{
+			name: "remove",
+			update: func(cfg *Configuration) error {
+				return RemoveEndpoint(cfg, "api", "10.0.0.2:8080")
+			},
+			want: []Endpoint{initial[0], initial[2]},
+		},
+		{
+			name: "remove unknown",
+			update: func(cfg *Configuration) error {
+				return RemoveEndpoint(cfg, "api", "10.0.0.9:8080")
+			},
+			wantErr: true,
+		},
+		{
+			name: "drain",
+			update: func(cfg *Configuration) error {
+				return DrainEndpoint(cfg, "api", "10.0.0.1:8080")
+			},
+			want: []Endpoint{{Address: "10.0.0.1:8080", Weight: 5, Draining: true}, initial[1], initial[2]},
+		},
+		{
+			name: "drain unknown",
+			update: func(cfg *Configuration) error {
+				return DrainEndpoint(cfg, "api", "10.0.0.9:8080")
+			},
+			wantErr: true,
+		},
+		{
+			name: "set weight",
+			update: func(cfg *Configuration) error {
+				return SetEndpointWeight(cfg, "api", "10.0.0.2:8080", 4)
+			},
+			want: []Endpoint{initial[0], {Address: "10.0.0.2:8080", Weight: 4, Draining: true}, initial[2]},
+		},
+		{
+			name: "set zero weight",
+			update: func(cfg *Configuration) error {
+				return SetEndpointWeight(cfg, "api", "10.0.0.1:8080", 0)
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown cluster",
+			update: func(cfg *Configuration) error {
+				return AddEndpoint(cfg, "web", "10.0.0.1:8080", nil)
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid cluster name",
+			update: func(cfg *Configuration) error {
+				return AddEndpoint(cfg, "../api", "10.0.0.1:8080", nil)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := setupEndpointsFile(t, initial)
+			file, _ := edsFilePath(cfg, "api")
+			before, _ := os.ReadFile(file)
+
+			err := tc.update(cfg)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("want error")
+				}
+				after, _ := os.ReadFile(file)
+				if string(after) != string(before) {
+					t.Errorf("endpoints file is modified on error:\n%s", after)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("update endpoints: %v", err)
+			}
+			got, err := ListEndpoints(cfg, "api")
+			if err != nil {
+				t.Fatalf("ListEndpoints: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("endpoints got %v, want %v", got, tc.want)
+			}
+			if _, err = os.Stat(file + ".tmp"); !os.IsNotExist(err) {
+				t.Errorf("temporary file is left: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpdateEndpointsConcurrently(t *testing.T) {
+	cfg := setupEndpointsFile(t, []Endpoint{{Address: "10.0.0.1:8080"}})
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- AddEndpoint(cfg, "api", fmt.Sprintf("10.0.1.%d:8080", i), nil)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("AddEndpoint: %v", err)
+		}
+	}
+
+	got, err := ListEndpoints(cfg, "api")
+	if err != nil {
+		t.Fatalf("ListEndpoints: %v", err)
+	}
+	if len(got) != n+1 {
+		t.Errorf("got %d endpoints, want %d, updates are lost: %v", len(got), n+1, got)
+	}
+}
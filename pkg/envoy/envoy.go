@@ -1,6 +1,7 @@
 package envoy
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -20,6 +21,22 @@ func Run(cfg *Configuration, restartEpoch int) (chan struct{}, error) {
 		return nil, errors.WithMessage(err, "generate config files")
 	}
 
+	var discovery *Discovery
+	if len(cfg.Discovery.Clusters) > 0 {
+		discovery, err = NewDiscovery(cfg)
+		if err != nil {
+			return nil, errors.WithMessage(err, "create discovery")
+		}
+		discovery.RunOnce(context.Background())
+	}
+
+	for _, dir := range gen.AccessLogDirs() {
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "create access log directory %s", dir)
+		}
+	}
+
 	setSystemParams(cfg)
 
 	cmdArgs := []string{
@@ -51,10 +68,15 @@ func Run(cfg *Configuration, restartEpoch int) (chan struct{}, error) {
 	}
 
 	exit := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
 		command.Wait()
+		cancel()
 		close(exit)
 	}()
+	if discovery != nil {
+		go discovery.Run(ctx)
+	}
 
 	return exit, nil
 }
@@ -0,0 +1,206 @@
+package envoy
+
+import (
+	"fmt"
+)
+
+// http3MarkerKey marks a filter chain or an HCM filter to enable HTTP/3.
+// It is removed from the generated configuration by addHTTP3Listeners.
+const http3MarkerKey = "__myeep_http3__"
+
+const (
+	hcmFilterName = "envoy.filters.network.http_connection_manager"
+
+	altSvcMaxAge = 86400
+)
+
+// addHTTP3Listeners generates companion QUIC listeners for listeners
+// which have filter chains marked to enable HTTP/3.
+//
+// A QUIC listener listens on the same address and port with UDP protocol,
+// it has the same certificates and HTTP connection managers as the TCP
+// listener. An "alt-svc" response header is added to the routes of
+// the TCP listener to advertise HTTP/3.
+func addHTTP3Listeners(data any) (any, error) {
+	listeners, ok := data.([]any)
+	if !ok {
+		return data, nil
+	}
+
+	var quicListeners []any
+	for i, x := range listeners {
+		listener, ok := x.(map[string]any)
+		if !ok {
+			continue
+		}
+		quicListener, err := buildQUICListener(listener)
+		if err != nil {
+			return nil, fmt.Errorf("listeners[%d]: %w", i, err)
+		}
+		if quicListener != nil {
+			quicListeners = append(quicListeners, quicListener)
+		}
+	}
+	return append(listeners, quicListeners...), nil
+}
+
+func buildQUICListener(listener map[string]any) (map[string]any, error) {
+	chains, _ := listener["filter_chains"].([]any)
+
+	var quicChains []any
+	for i, x := range chains {
+		chain, ok := x.(map[string]any)
+		if !ok {
+			continue
+		}
+		if !popHTTP3Marker(chain) {
+			continue
+		}
+		port, err := getListenerPort(listener)
+		if err != nil {
+			return nil, err
+		}
+		quicChain, err := buildQUICFilterChain(chain, port)
+		if err != nil {
+			return nil, fmt.Errorf("filter_chains[%d]: %w", i, err)
+		}
+		quicChains = append(quicChains, quicChain)
+	}
+	if len(quicChains) == 0 {
+		return nil, nil
+	}
+
+	address := deepCopy(listener["address"]).(map[string]any)
+	address["socket_address"].(map[string]any)["protocol"] = "UDP"
+	quicListener := map[string]any{
+		"name":    fmt.Sprint(listener["name"]) + "_quic",
+		"address": address,
+		"udp_listener_config": map[string]any{
+			"quic_options": map[string]any{},
+			"downstream_socket_config": map[string]any{
+				"prefer_gro": true,
+			},
+		},
+		"filter_chains": quicChains,
+	}
+	if typ, ok := listener["@type"]; ok {
+		quicListener["@type"] = typ
+	}
+	return quicListener, nil
+}
+
+// popHTTP3Marker reports whether a filter chain is marked to enable HTTP/3,
+// either on the chain or on the HCM filter, the markers are removed.
+func popHTTP3Marker(chain map[string]any) bool {
+	enabled := chain[http3MarkerKey] == true
+	delete(chain, http3MarkerKey)
+	filters, _ := chain["filters"].([]any)
+	for _, x := range filters {
+		if filter, ok := x.(map[string]any); ok {
+			if filter[http3MarkerKey] == true {
+				enabled = true
+			}
+			delete(filter, http3MarkerKey)
+		}
+	}
+	return enabled
+}
+
+func getListenerPort(listener map[string]any) (int, error) {
+	address, _ := listener["address"].(map[string]any)
+	sockAddr, _ := address["socket_address"].(map[string]any)
+	port, ok := sockAddr["port_value"].(int)
+	if !ok {
+		return 0, fmt.Errorf("http3 requires a listener with socket address")
+	}
+	if sockAddr["protocol"] == "UDP" {
+		return 0, fmt.Errorf("http3 requires a TCP listener")
+	}
+	return port, nil
+}
+
+func buildQUICFilterChain(chain map[string]any, port int) (map[string]any, error) {
+	transportSocket, _ := chain["transport_socket"].(map[string]any)
+	tlsConfig, _ := transportSocket["typed_config"].(map[string]any)
+	if tlsConfig == nil || tlsConfig["@type"] != "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.DownstreamTlsContext" {
+		return nil, fmt.Errorf("http3 requires a filter chain with downstream TLS context")
+	}
+	downstreamTLSContext := deepCopy(tlsConfig).(map[string]any)
+	delete(downstreamTLSContext, "@type")
+
+	quicChain := map[string]any{
+		"transport_socket": map[string]any{
+			"name": "envoy.transport_sockets.quic",
+			"typed_config": map[string]any{
+				"@type":                  "type.googleapis.com/envoy.extensions.transport_sockets.quic.v3.QuicDownstreamTransport",
+				"downstream_tls_context": downstreamTLSContext,
+			},
+		},
+	}
+	if match, ok := chain["filter_chain_match"].(map[string]any); ok {
+		quicMatch := deepCopy(match).(map[string]any)
+		delete(quicMatch, "transport_protocol")
+		delete(quicMatch, "application_protocols")
+		quicChain["filter_chain_match"] = quicMatch
+	}
+
+	altSvc := fmt.Sprintf(`h3=":%d"; ma=%d`, port, altSvcMaxAge)
+	filters, _ := chain["filters"].([]any)
+	var quicFilters []any
+	for _, x := range filters {
+		filter, ok := x.(map[string]any)
+		if !ok || filter["name"] != hcmFilterName {
+			quicFilters = append(quicFilters, deepCopy(x))
+			continue
+		}
+		hcmConfig, _ := filter["typed_config"].(map[string]any)
+		addAltSvcHeader(hcmConfig, altSvc)
+
+		quicFilter := deepCopy(filter).(map[string]any)
+		quicConfig := quicFilter["typed_config"].(map[string]any)
+		quicConfig["codec_type"] = "HTTP3"
+		quicConfig["http3_protocol_options"] = map[string]any{}
+		delete(quicConfig, "http2_protocol_options")
+		delete(quicConfig, "upgrade_configs")
+		quicFilters = append(quicFilters, quicFilter)
+	}
+	if len(quicFilters) == 0 {
+		return nil, fmt.Errorf("http3 requires http_connection_manager filter")
+	}
+	quicChain["filters"] = quicFilters
+	return quicChain, nil
+}
+
+func addAltSvcHeader(hcmConfig map[string]any, altSvc string) {
+	routeConfig, ok := hcmConfig["route_config"].(map[string]any)
+	if !ok {
+		return
+	}
+	headers, _ := routeConfig["response_headers_to_add"].([]any)
+	routeConfig["response_headers_to_add"] = append(headers, map[string]any{
+		"header": map[string]any{
+			"key":   "alt-svc",
+			"value": altSvc,
+		},
+		"append_action": "OVERWRITE_IF_EXISTS_OR_ADD",
+	})
+}
+
+// deepCopy copies maps and slices recursively.
+func deepCopy(x any) any {
+	switch val := x.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, v := range val {
+			out[k] = deepCopy(v)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, v := range val {
+			out[i] = deepCopy(v)
+		}
+		return out
+	}
+	return x
+}
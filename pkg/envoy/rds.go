@@ -0,0 +1,102 @@
+package envoy
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const routeConfigurationType = "type.googleapis.com/envoy.config.route.v3.RouteConfiguration"
+
+// extractRouteConfigs replaces the inline route configurations of HCM
+// filters by file-based RDS, each route configuration is loaded from
+// the file "<routesDir>/<name>.yaml".
+//
+// Envoy accepts exactly one route configuration from an RDS file, thus
+// every route configuration is written to a separate file.
+// HCM filters may share a route configuration by name, in which case
+// they must have identical route configurations.
+func extractRouteConfigs(data any, routesDir string) (map[string]any, error) {
+	listeners, ok := data.([]any)
+	if !ok {
+		return nil, nil
+	}
+
+	routeConfigs := make(map[string]any)
+	for i, x := range listeners {
+		listener, ok := x.(map[string]any)
+		if !ok {
+			continue
+		}
+		chains, _ := listener["filter_chains"].([]any)
+		if defaultChain, ok := listener["default_filter_chain"]; ok {
+			chains = append(chains[:len(chains):len(chains)], defaultChain)
+		}
+		for _, chain := range chains {
+			chain, ok := chain.(map[string]any)
+			if !ok {
+				continue
+			}
+			filters, _ := chain["filters"].([]any)
+			for _, filter := range filters {
+				filter, ok := filter.(map[string]any)
+				if !ok || filter["name"] != hcmFilterName {
+					continue
+				}
+				hcmConfig, _ := filter["typed_config"].(map[string]any)
+				err := extractHCMRouteConfig(hcmConfig, routesDir, routeConfigs)
+				if err != nil {
+					return nil, fmt.Errorf("listeners[%d] %v: %w", i, listener["name"], err)
+				}
+			}
+		}
+	}
+	return routeConfigs, nil
+}
+
+func extractHCMRouteConfig(hcmConfig map[string]any, routesDir string, routeConfigs map[string]any) error {
+	routeConfig, ok := hcmConfig["route_config"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	name, _ := routeConfig["name"].(string)
+	if name == "" {
+		return fmt.Errorf("route_config name is required by RDS")
+	}
+	if strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("route_config name %q cannot be used as file name", name)
+	}
+
+	rc := make(map[string]any, len(routeConfig)+1)
+	for k, v := range routeConfig {
+		rc[k] = v
+	}
+	rc["@type"] = routeConfigurationType
+	if exists, ok := routeConfigs[name]; ok && !reflect.DeepEqual(exists, rc) {
+		return fmt.Errorf("route_config %q is defined multiple times with different content", name)
+	}
+	routeConfigs[name] = rc
+
+	delete(hcmConfig, "route_config")
+	hcmConfig["rds"] = map[string]any{
+		"route_config_name": name,
+		"config_source": map[string]any{
+			"resource_api_version": "V3",
+			"path_config_source": map[string]any{
+				"path": filepath.Join(routesDir, name+".yaml"),
+			},
+		},
+	}
+	return nil
+}
+
+func sortedRouteConfigNames(routeConfigs map[string]any) []string {
+	names := make([]string, 0, len(routeConfigs))
+	for name := range routeConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
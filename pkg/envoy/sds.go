@@ -0,0 +1,254 @@
+package envoy
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	sdsModeGRPC   = "grpc"
+	sdsModeFile   = "file"
+	sdsModeInline = "inline"
+
+	simpleSSLProviderName = "simplessl"
+)
+
+// SDSProvider configures a provider of TLS secrets, which is referenced
+// as "provider:secret" by the "sds_tls" command.
+type SDSProvider struct {
+	Name string `yaml:"name"`
+
+	// Mode is one of "grpc" (default), "file" and "inline".
+	//
+	// In grpc mode, secrets are fetched from the SDS server at Address,
+	// a cluster "sds_<name>" is generated in the bootstrap config.
+	// In file mode, a secret "name" is loaded from "<Dir>/<name>.yaml",
+	// which contains a Secret resource, the file is watched by Envoy.
+	// In inline mode, secrets are certificate files given in Secrets.
+	Mode string `yaml:"mode"`
+
+	Address string          `yaml:"address"`
+	TLS     *SDSProviderTLS `yaml:"tls"`
+
+	Dir string `yaml:"dir"`
+
+	Secrets map[string]SDSInlineSecret `yaml:"secrets"`
+
+	clusterName string
+}
+
+// SDSProviderTLS configures the TLS connection to an SDS server.
+type SDSProviderTLS struct {
+	SNI        string `yaml:"sni"`
+	CACert     string `yaml:"caCert"`
+	ClientCert string `yaml:"clientCert"`
+	ClientKey  string `yaml:"clientKey"`
+}
+
+type SDSInlineSecret struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+func (sp *SDSProvider) normalize() error {
+	if sp.Name == "" {
+		return fmt.Errorf("sds provider: name is required")
+	}
+	if sp.Mode == "" {
+		sp.Mode = sdsModeGRPC
+	}
+	switch sp.Mode {
+	case sdsModeGRPC:
+		if sp.Address == "" {
+			return fmt.Errorf("sds provider %s: address is required in grpc mode", sp.Name)
+		}
+		if tls := sp.TLS; tls != nil && (tls.ClientCert == "") != (tls.ClientKey == "") {
+			return fmt.Errorf("sds provider %s: clientCert and clientKey must be specified together", sp.Name)
+		}
+		if sp.clusterName == "" {
+			sp.clusterName = "sds_" + sp.Name
+		}
+	case sdsModeFile:
+		if sp.Dir == "" {
+			return fmt.Errorf("sds provider %s: dir is required in file mode", sp.Name)
+		}
+	case sdsModeInline:
+		if len(sp.Secrets) == 0 {
+			return fmt.Errorf("sds provider %s: secrets is required in inline mode", sp.Name)
+		}
+		for name, secret := range sp.Secrets {
+			if secret.Cert == "" || secret.Key == "" {
+				return fmt.Errorf("sds provider %s: secret %s requires cert and key", sp.Name, name)
+			}
+		}
+	default:
+		return fmt.Errorf("sds provider %s: unsupported mode %q", sp.Name, sp.Mode)
+	}
+	return nil
+}
+
+// getSDSProviders returns the configured SDS providers, SimpleSSL is
+// added as the provider "simplessl" if it is enabled.
+func (cfg *Configuration) getSDSProviders() ([]*SDSProvider, error) {
+	providers := make([]*SDSProvider, 0, len(cfg.SDS.Providers)+1)
+	names := make(map[string]bool)
+	for _, sp := range cfg.SDS.Providers {
+		if err := sp.normalize(); err != nil {
+			return nil, err
+		}
+		if names[sp.Name] {
+			return nil, fmt.Errorf("sds provider %s: duplicate name", sp.Name)
+		}
+		names[sp.Name] = true
+		providers = append(providers, sp)
+	}
+	if cfg.SimpleSSL.Enable && !names[simpleSSLProviderName] {
+		sp := &SDSProvider{
+			Name:    simpleSSLProviderName,
+			Address: cfg.SimpleSSL.SDSAddr,
+			TLS: &SDSProviderTLS{
+				ClientCert: cfg.SimpleSSL.ClientCert,
+				ClientKey:  cfg.SimpleSSL.ClientKey,
+			},
+			clusterName: "sds_server_mtls",
+		}
+		if err := sp.normalize(); err != nil {
+			return nil, err
+		}
+		providers = append(providers, sp)
+	}
+	return providers, nil
+}
+
+// getSDSProvider parses a secret reference in the format
+// "provider:secret", if provider is omitted, the default provider is
+// used, which is configured by "sds.defaultProvider", or the only
+// provider if there is only one, or "simplessl" if it is enabled.
+func (cfg *Configuration) getSDSProvider(ref string) (*SDSProvider, string, error) {
+	providers, err := cfg.getSDSProviders()
+	if err != nil {
+		return nil, "", err
+	}
+	name, secret, ok := strings.Cut(ref, ":")
+	if !ok {
+		name, secret = cfg.SDS.DefaultProvider, ref
+		if name == "" {
+			switch {
+			case len(providers) == 0:
+				return nil, "", fmt.Errorf("no sds provider configured")
+			case len(providers) == 1:
+				name = providers[0].Name
+			case cfg.SimpleSSL.Enable:
+				name = simpleSSLProviderName
+			default:
+				return nil, "", fmt.Errorf("secret %q: provider is required when sds.defaultProvider is not configured", ref)
+			}
+		}
+	}
+	if secret == "" {
+		return nil, "", fmt.Errorf("secret %q: empty secret name", ref)
+	}
+	for _, sp := range providers {
+		if sp.Name == name {
+			return sp, secret, nil
+		}
+	}
+	return nil, "", fmt.Errorf("secret %q: unknown sds provider %q", ref, name)
+}
+
+// sdsCluster generates the cluster of a grpc mode provider.
+func (sp *SDSProvider) sdsCluster(p *YAMLParser) (any, error) {
+	tmpl := `
+name: "{{ .clusterName }}"
+typed_extension_protocol_options:
+  envoy.extensions.upstreams.http.v3.HttpProtocolOptions:
+    "@type": type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions
+    explicit_http_config:
+      http2_protocol_options:
+        connection_keepalive:
+          interval: 30s
+          timeout: 5s
+load_assignment:
+  cluster_name: "{{ .clusterName }}"
+  endpoints:
+    - lb_endpoints:
+        - endpoint:
+            "!@@ address": "{{ .Address }}"
+`
+	result, err := p.parseYAML(tmpl, map[string]any{
+		"clusterName": sp.clusterName,
+		"Address":     sp.Address,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cluster := result.(map[string]any)
+	if tls := sp.TLS; tls != nil {
+		transportSocket, err := p.upstreamTransportSocket(&upstreamTLSArgs{
+			SNI:  tls.SNI,
+			CA:   tls.CACert,
+			Cert: tls.ClientCert,
+			Key:  tls.ClientKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("sds provider %s: %w", sp.Name, err)
+		}
+		cluster["transport_socket"] = transportSocket
+	}
+	return cluster, nil
+}
+
+// commonTLSContext generates the common_tls_context which references
+// the secret from the provider.
+func (sp *SDSProvider) commonTLSContext(secret string) (map[string]any, error) {
+	switch sp.Mode {
+	case sdsModeInline:
+		s, ok := sp.Secrets[secret]
+		if !ok {
+			return nil, fmt.Errorf("sds provider %s: unknown secret %q", sp.Name, secret)
+		}
+		return map[string]any{
+			"tls_certificates": []any{
+				map[string]any{
+					"certificate_chain": map[string]any{"filename": s.Cert},
+					"private_key":       map[string]any{"filename": s.Key},
+				},
+			},
+		}, nil
+	case sdsModeFile:
+		path := filepath.Join(sp.Dir, secret+".yaml")
+		return sdsSecretConfigs(secret, map[string]any{
+			"resource_api_version": "V3",
+			"path_config_source": map[string]any{
+				"path": path,
+				"watched_directory": map[string]any{
+					"path": filepath.Dir(path),
+				},
+			},
+		}), nil
+	}
+	return sdsSecretConfigs(secret, map[string]any{
+		"resource_api_version": "V3",
+		"api_config_source": map[string]any{
+			"api_type":              "GRPC",
+			"transport_api_version": "V3",
+			"grpc_services": map[string]any{
+				"envoy_grpc": map[string]any{
+					"cluster_name": sp.clusterName,
+				},
+			},
+		},
+	}), nil
+}
+
+func sdsSecretConfigs(secret string, sdsConfig map[string]any) map[string]any {
+	return map[string]any{
+		"tls_certificate_sds_secret_configs": []any{
+			map[string]any{
+				"name":       secret,
+				"sds_config": sdsConfig,
+			},
+		},
+	}
+}
@@ -0,0 +1,167 @@
+package envoy
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	tracingProviderOpenTelemetry = "opentelemetry"
+	tracingProviderZipkin        = "zipkin"
+
+	tracingClusterName = "tracing_collector"
+)
+
+// TracingTag is a custom tag added to spans, the value is one of
+// a literal Value, a request Header, or an environment variable Env.
+type TracingTag struct {
+	Name   string `yaml:"name"`
+	Value  string `yaml:"value"`
+	Header string `yaml:"header"`
+	Env    string `yaml:"env"`
+}
+
+func (cfg *Configuration) tracingEnabled() bool {
+	return cfg.Tracing.Provider != ""
+}
+
+func (cfg *Configuration) validateTracing() error {
+	tr := &cfg.Tracing
+	switch tr.Provider {
+	case tracingProviderOpenTelemetry:
+	case tracingProviderZipkin:
+		if tr.ServiceName != "" {
+			return fmt.Errorf("tracing: serviceName is not supported by zipkin, which uses nodeCluster")
+		}
+	default:
+		return fmt.Errorf("tracing: unsupported provider %q", tr.Provider)
+	}
+	if tr.Address == "" {
+		return fmt.Errorf("tracing: address is required")
+	}
+	if _, err := parseAddress(tr.Address); err != nil {
+		return fmt.Errorf("tracing: %w", err)
+	}
+	if r := tr.SamplingRate; r != nil && (*r < 0 || *r > 100) {
+		return fmt.Errorf("tracing: samplingRate must be in range [0, 100], got %v", *r)
+	}
+	for i, tag := range tr.Tags {
+		if tag.Name == "" {
+			return fmt.Errorf("tracing tags[%d]: name is required", i)
+		}
+		n := 0
+		for _, v := range []string{tag.Value, tag.Header, tag.Env} {
+			if v != "" {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("tracing tag %s: exactly one of value, header and env is required", tag.Name)
+		}
+	}
+	return nil
+}
+
+// tracingClusterYAML generates the collector cluster by the
+// "simple_cluster" command, it is added to clusters.yaml when tracing
+// is enabled.
+func (cfg *Configuration) tracingClusterYAML() ([]byte, error) {
+	if err := cfg.validateTracing(); err != nil {
+		return nil, err
+	}
+	addr, _ := parseAddress(cfg.Tracing.Address)
+	args := map[string]any{
+		"name":      tracingClusterName,
+		"endpoints": []any{cfg.Tracing.Address},
+	}
+	if addr.IsHostname {
+		args["type"] = "strict_dns"
+	}
+	if cfg.Tracing.Provider == tracingProviderOpenTelemetry {
+		args["protocol"] = "http2"
+	}
+	clusters := []any{
+		map[string]any{cmdPrefix + "simple_cluster": args},
+	}
+	out, err := yaml.Marshal(clusters)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("\n# tracing collector\n"), out...), nil
+}
+
+// tracingConfig generates the tracing block of HTTP connection managers.
+func (cfg *Configuration) tracingConfig() (map[string]any, error) {
+	if err := cfg.validateTracing(); err != nil {
+		return nil, err
+	}
+	tr := &cfg.Tracing
+
+	var provider map[string]any
+	switch tr.Provider {
+	case tracingProviderOpenTelemetry:
+		serviceName := tr.ServiceName
+		if serviceName == "" {
+			serviceName = cfg.NodeCluster
+		}
+		provider = map[string]any{
+			"name": "envoy.tracers.opentelemetry",
+			"typed_config": map[string]any{
+				"@type": "type.googleapis.com/envoy.config.trace.v3.OpenTelemetryConfig",
+				"grpc_service": map[string]any{
+					"envoy_grpc": map[string]any{
+						"cluster_name": tracingClusterName,
+					},
+					"timeout": "0.250s",
+				},
+				"service_name": serviceName,
+			},
+		}
+	case tracingProviderZipkin:
+		path := tr.ZipkinPath
+		if path == "" {
+			path = "/api/v2/spans"
+		}
+		provider = map[string]any{
+			"name": "envoy.tracers.zipkin",
+			"typed_config": map[string]any{
+				"@type":                      "type.googleapis.com/envoy.config.trace.v3.ZipkinConfig",
+				"collector_cluster":          tracingClusterName,
+				"collector_endpoint":         path,
+				"collector_endpoint_version": "HTTP_JSON",
+			},
+		}
+	}
+
+	tracing := map[string]any{
+		"provider": provider,
+	}
+	if tr.SamplingRate != nil {
+		tracing["random_sampling"] = map[string]any{"value": *tr.SamplingRate}
+	}
+	var tags []any
+	for _, tag := range tr.Tags {
+		switch {
+		case tag.Value != "":
+			tags = append(tags, map[string]any{
+				"tag":     tag.Name,
+				"literal": map[string]any{"value": tag.Value},
+			})
+		case tag.Header != "":
+			tags = append(tags, map[string]any{
+				"tag":            tag.Name,
+				"request_header": map[string]any{"name": tag.Header},
+			})
+		default:
+			tags = append(tags, map[string]any{
+				"tag":         tag.Name,
+				"environment": map[string]any{"name": tag.Env},
+			})
+		}
+	}
+	if len(tags) > 0 {
+		tracing["custom_tags"] = tags
+	}
+	return tracing, nil
+}
@@ -0,0 +1,277 @@
+package envoy
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func floatPtr(x float64) *float64 { return &x }
+
+func TestTracingConfig(t *testing.T) {
+	testCases := []struct {
+		name    string
+		setup   func(cfg *Configuration)
+		want    string
+		wantErr string
+	}{
+		{
+			name: "opentelemetry",
+			setup: func(cfg *Configuration) {
+				cfg.Tracing.Provider = "opentelemetry"
+				cfg.Tracing.Address = "127.0.0.1:4317"
+			},
+			want: `
+provider:
+  name: envoy.tracers.opentelemetry
+  typed_config:
+    "@type": type.googleapis.com/envoy.config.trace.v3.OpenTelemetryConfig
+    grpc_service:
+      envoy_grpc: { cluster_name: tracing_collector }
+      timeout: 0.250s
+    service_name: test
+`,
+		},
+		{
+			name: "opentelemetry service name",
+			setup: func(cfg *Configuration) {
+				cfg.Tracing.Provider = "opentelemetry"
+				cfg.Tracing.Address = "otel-collector:4317"
+				cfg.Tracing.ServiceName = "edge"
+				cfg.Tracing.SamplingRate = floatPtr(0)
+			},
+			want: `
+provider:
+  name: envoy.tracers.opentelemetry
+  typed_config:
+    "@type": type.googleapis.com/envoy.config.trace.v3.OpenTelemetryConfig
+    grpc_service:
+      envoy_grpc: { cluster_name: tracing_collector }
+      timeout: 0.250s
+    service_name: edge
+random_sampling: { value: 0.0 }
+`,
+		},
+		{
+			name: "zipkin",
+			setup: func(cfg *Configuration) {
+				cfg.Tracing.Provider = "zipkin"
+				cfg.Tracing.Address = "127.0.0.1:9411"
+				cfg.Tracing.SamplingRate = floatPtr(100)
+				cfg.Tracing.Tags = []*TracingTag{
+					{Name: "env", Value: "production"},
+					{Name: "user_agent", Header: "user-agent"},
+					{Name: "pod", Env: "POD_NAME"},
+				}
+			},
+			want: `
+provider:
+  name: envoy.tracers.zipkin
+  typed_config:
+    "@type": type.googleapis.com/envoy.config.trace.v3.ZipkinConfig
+    collector_cluster: tracing_collector
+    collector_endpoint: /api/v2/spans
+    collector_endpoint_version: HTTP_JSON
+random_sampling: { value: 100.0 }
+custom_tags:
+  - { tag: env, literal: { value: production } }
+  - { tag: user_agent, request_header: { name: user-agent } }
+  - { tag: pod, environment: { name: POD_NAME } }
+`,
+		},
+		{
+			name: "zipkin service name",
+			setup: func(cfg *Configuration) {
+				cfg.Tracing.Provider = "zipkin"
+				cfg.Tracing.Address = "127.0.0.1:9411"
+				cfg.Tracing.ServiceName = "edge"
+			},
+			wantErr: "serviceName is not supported by zipkin",
+		},
+		{
+			name: "unsupported provider",
+			setup: func(cfg *Configuration) {
+				cfg.Tracing.Provider = "jaeger"
+				cfg.Tracing.Address = "127.0.0.1:6831"
+			},
+			wantErr: "unsupported provider",
+		},
+		{
+			name: "missing address",
+			setup: func(cfg *Configuration) {
+				cfg.Tracing.Provider = "zipkin"
+			},
+			wantErr: "address is required",
+		},
+		{
+			name: "invalid address",
+			setup: func(cfg *Configuration) {
+				cfg.Tracing.Provider = "zipkin"
+				cfg.Tracing.Address = "127.0.0.1"
+			},
+			wantErr: "invalid address",
+		},
+		{
+			name: "sampling rate below 0",
+			setup: func(cfg *Configuration) {
+				cfg.Tracing.Provider = "zipkin"
+				cfg.Tracing.Address = "127.0.0.1:9411"
+				cfg.Tracing.SamplingRate = floatPtr(-0.1)
+			},
+			wantErr: "samplingRate must be in range",
+		},
+		{
+			name: "sampling rate above 100",
+			setup: func(cfg *Configuration) {
+				cfg.Tracing.Provider = "zipkin"
+				cfg.Tracing.Address = "127.0.0.1:9411"
+				cfg.Tracing.SamplingRate = floatPtr(100.5)
+			},
+			wantErr: "samplingRate must be in range",
+		},
+		{
+			name: "tag without name",
+			setup: func(cfg *Configuration) {
+				cfg.Tracing.Provider = "zipkin"
+				cfg.Tracing.Address = "127.0.0.1:9411"
+				cfg.Tracing.Tags = []*TracingTag{{Value: "x"}}
+			},
+			wantErr: "name is required",
+		},
+		{
+			name: "tag without value",
+			setup: func(cfg *Configuration) {
+				cfg.Tracing.Provider = "zipkin"
+				cfg.Tracing.Address = "127.0.0.1:9411"
+				cfg.Tracing.Tags = []*TracingTag{{Name: "env"}}
+			},
+			wantErr: "exactly one of value, header and env",
+		},
+		{
+			name: "tag with two values",
+			setup: func(cfg *Configuration) {
+				cfg.Tracing.Provider = "zipkin"
+				cfg.Tracing.Address = "127.0.0.1:9411"
+				cfg.Tracing.Tags = []*TracingTag{{Name: "env", Value: "x", Header: "x-env"}}
+			},
+			wantErr: "exactly one of value, header and env",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Configuration{NodeCluster: "test"}
+			tc.setup(cfg)
+			got, err := cfg.tracingConfig()
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("tracingConfig got error %v, want %q", err, tc.wantErr)
+				}
+				if _, err = cfg.tracingClusterYAML(); err == nil {
+					t.Errorf("tracingClusterYAML want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("tracingConfig: %v", err)
+			}
+			// Compare the printed values, as the tags are []any of maps.
+			want := mustParseYAML(t, tc.want)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("tracingConfig got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestTracingClusterYAML(t *testing.T) {
+	testCases := []struct {
+		name     string
+		provider string
+		address  string
+		want     string
+	}{
+		{
+			name:     "opentelemetry",
+			provider: "opentelemetry",
+			address:  "127.0.0.1:4317",
+			want:     `[{"!@@ simple_cluster": {name: tracing_collector, endpoints: ["127.0.0.1:4317"], protocol: http2}}]`,
+		},
+		{
+			name:     "zipkin",
+			provider: "zipkin",
+			address:  "127.0.0.1:9411",
+			want:     `[{"!@@ simple_cluster": {name: tracing_collector, endpoints: ["127.0.0.1:9411"]}}]`,
+		},
+		{
+			name:     "hostname",
+			provider: "zipkin",
+			address:  "zipkin.example.com:9411",
+			want:     `[{"!@@ simple_cluster": {name: tracing_collector, endpoints: ["zipkin.example.com:9411"], type: strict_dns}}]`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Configuration{NodeCluster: "test"}
+			cfg.Tracing.Provider = tc.provider
+			cfg.Tracing.Address = tc.address
+			out, err := cfg.tracingClusterYAML()
+			if err != nil {
+				t.Fatalf("tracingClusterYAML: %v", err)
+			}
+			got := mustParseYAML(t, string(out))
+			want := mustParseYAML(t, tc.want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("tracingClusterYAML got %v, want %v", got, want)
+			}
+
+			// The cluster is solved by the "simple_cluster" command.
+			p := &YAMLParser{cfg: cfg}
+			if _, err = p.solveCommands("clusters", got); err != nil {
+				t.Errorf("solve tracing cluster: %v", err)
+			}
+		})
+	}
+}
+
+func TestHCMTracing(t *testing.T) {
+	const hcm = `{"!@@ hcm": {stat_prefix: ingress_http, %s virtual_hosts: [{name: default, domains: ["*"], routes: []}]}}`
+	testCases := []struct {
+		name        string
+		provider    string
+		option      string
+		wantTracing bool
+		wantErr     bool
+	}{
+		{name: "enabled by default", provider: "zipkin", wantTracing: true},
+		{name: "explicitly enabled", provider: "zipkin", option: "tracing: true,", wantTracing: true},
+		{name: "opt out", provider: "zipkin", option: "tracing: false,"},
+		{name: "not configured", wantTracing: false},
+		{name: "opt out not configured", option: "tracing: false,"},
+		{name: "enabled not configured", option: "tracing: true,", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Configuration{NodeCluster: "test"}
+			if tc.provider != "" {
+				cfg.Tracing.Provider = tc.provider
+				cfg.Tracing.Address = "127.0.0.1:9411"
+			}
+			p := &YAMLParser{cfg: cfg}
+			got, err := p.solveCommands("listeners", mustParseYAML(t, fmt.Sprintf(hcm, tc.option)))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("solveCommands: %v", err)
+			}
+			config := got.(map[string]any)["typed_config"].(map[string]any)
+			if _, ok := config["tracing"]; ok != tc.wantTracing {
+				t.Errorf("tracing got %v, want %v", config["tracing"], tc.wantTracing)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package envoy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jxskiss/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ShiftTraffic rewrites the cluster weights of the "weighted_route"
+// named route in listeners.yaml, then regenerates the configuration
+// files. The weights must sum to 100, and the clusters must be defined
+// in clusters.yaml, clusters not in weights are removed from the route.
+//
+// listeners.yaml is edited in place, only the lines of the clusters
+// mapping are replaced, thus comments and templates elsewhere in the
+// file are preserved. The edited file is parsed again to make sure
+// that the route has exactly the new weights before it is written,
+// and the original file is restored if generating fails.
+func ShiftTraffic(cfg *Configuration, route string, weights map[string]int) error {
+	if err := validateClusterWeights(weights); err != nil {
+		return errors.WithMessagef(err, "route %s", route)
+	}
+	if err := checkClustersDefined(cfg, weights); err != nil {
+		return errors.WithMessagef(err, "route %s", route)
+	}
+
+	file := filepath.Join(cfg.confDir, "listeners.yaml")
+	original, err := os.ReadFile(file)
+	if err != nil {
+		return errors.WithMessage(err, "read listeners.yaml")
+	}
+	var root yaml.Node
+	if err = yaml.Unmarshal(original, &root); err != nil {
+		return errors.WithMessage(err, "parse listeners.yaml")
+	}
+	clusters := findWeightedRouteClusters(&root, route)
+	if clusters == nil {
+		return fmt.Errorf("weighted_route %q not found in listeners.yaml", route)
+	}
+	content, err := replaceClusterWeights(original, clusters, weights)
+	if err != nil {
+		return errors.WithMessagef(err, "route %s", route)
+	}
+	if err = checkClusterWeights(content, route, weights); err != nil {
+		return errors.WithMessagef(err, "route %s: verify edited listeners.yaml", route)
+	}
+
+	if err = writeFileAtomic(file, content, 0644); err != nil {
+		return errors.WithMessage(err, "write listeners.yaml")
+	}
+	// Restore the original listeners.yaml if the configuration cannot be
+	// generated, else the edited weights are kept on disk while the
+	// generated configuration is stale.
+	if err = NewConfigGenerator(cfg).Generate(); err != nil {
+		if restoreErr := writeFileAtomic(file, original, 0644); restoreErr != nil {
+			return errors.WithMessagef(err, "restore listeners.yaml: %v", restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// checkClustersDefined checks that the clusters in weights are defined
+// in clusters.yaml.
+func checkClustersDefined(cfg *Configuration, weights map[string]int) error {
+	parser := &YAMLParser{cfg: cfg}
+	clusters, err := NewConfigGenerator(cfg).solveClustersConfig(parser)
+	if err != nil {
+		return err
+	}
+	defined := make(map[string]bool)
+	list, _ := clusters.([]any)
+	for _, x := range list {
+		if c, ok := x.(map[string]any); ok {
+			if name, ok := c["name"].(string); ok {
+				defined[name] = true
+			}
+		}
+	}
+	for name := range weights {
+		if !defined[name] {
+			return fmt.Errorf("cluster %q is not defined in clusters.yaml", name)
+		}
+	}
+	return nil
+}
+
+// checkClusterWeights parses the edited listeners.yaml, and checks that
+// the route has exactly the expected weights.
+func checkClusterWeights(content []byte, route string, weights map[string]int) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return err
+	}
+	clusters := findWeightedRouteClusters(&root, route)
+	if clusters == nil {
+		return fmt.Errorf("weighted_route not found")
+	}
+	var got map[string]int
+	if err := clusters.Decode(&got); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(got, weights) {
+		return fmt.Errorf("got weights %v, want %v", got, weights)
+	}
+	return nil
+}
+
+// findWeightedRouteClusters finds the clusters mapping node of the named
+// "weighted_route" command.
+func findWeightedRouteClusters(node *yaml.Node, route string) *yaml.Node {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, x := range node.Content {
+			if found := findWeightedRouteClusters(x, route); found != nil {
+				return found
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == cmdPrefix+"weighted_route" && value.Kind == yaml.MappingNode {
+				if name, clusters := weightedRouteNameAndClusters(value); name == route && clusters != nil {
+					return clusters
+				}
+			}
+			if found := findWeightedRouteClusters(value, route); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+func weightedRouteNameAndClusters(node *yaml.Node) (name string, clusters *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		switch node.Content[i].Value {
+		case "name":
+			name = node.Content[i+1].Value
+		case "clusters":
+			if node.Content[i+1].Kind == yaml.MappingNode {
+				clusters = node.Content[i+1]
+			}
+		}
+	}
+	return
+}
+
+func replaceClusterWeights(content []byte, clusters *yaml.Node, weights map[string]int) ([]byte, error) {
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(clusters.Content) == 0 {
+		return nil, fmt.Errorf("clusters mapping is empty")
+	}
+
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	first := clusters.Content[0].Line - 1
+	last := clusters.Content[len(clusters.Content)-1].Line - 1
+	for i, x := range clusters.Content {
+		if (i > 0 && x.HeadComment != "") || x.LineComment != "" || x.FootComment != "" {
+			return nil, fmt.Errorf("comments inside clusters mapping are not supported")
+		}
+	}
+
+	var replacement []byte
+	if clusters.Style&yaml.FlowStyle != 0 {
+		if first != last || clusters.Line-1 != first {
+			return nil, fmt.Errorf("multi-line flow mapping of clusters is not supported")
+		}
+		line := string(lines[first])
+		start := clusters.Column - 1
+		end := matchingBrace(line, start)
+		if end < 0 {
+			return nil, fmt.Errorf("cannot locate clusters mapping")
+		}
+		pairs := make([]string, 0, len(names))
+		for _, name := range names {
+			pairs = append(pairs, yamlKey(name)+": "+strconv.Itoa(weights[name]))
+		}
+		replacement = []byte(line[:start] + "{ " + strings.Join(pairs, ", ") + " }" + line[end+1:])
+	} else {
+		indent := strings.Repeat(" ", clusters.Content[0].Column-1)
+		var buf bytes.Buffer
+		for _, name := range names {
+			fmt.Fprintf(&buf, "%s%s: %d\n", indent, yamlKey(name), weights[name])
+		}
+		replacement = buf.Bytes()
+	}
+
+	var out bytes.Buffer
+	for i := 0; i < first; i++ {
+		out.Write(lines[i])
+	}
+	out.Write(replacement)
+	for i := last + 1; i < len(lines); i++ {
+		out.Write(lines[i])
+	}
+	return out.Bytes(), nil
+}
+
+// matchingBrace returns the index of the brace which closes the flow
+// mapping starting at start, or -1 if not found.
+func matchingBrace(line string, start int) int {
+	if start >= len(line) || line[start] != '{' {
+		return -1
+	}
+	depth := 0
+	var quote byte
+	for i := start; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// yamlKey quotes a cluster name if it is not a plain YAML scalar.
+func yamlKey(name string) string {
+	out, err := yaml.Marshal(name)
+	if err != nil {
+		return strconv.Quote(name)
+	}
+	return strings.TrimSpace(string(out))
+}
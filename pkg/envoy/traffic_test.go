@@ -0,0 +1,197 @@
+package envoy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupTrafficConf copies the traffic shift fixtures into a temporary
+// configuration directory.
+func setupTrafficConf(t *testing.T) (*Configuration, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"listeners.yaml", "clusters.yaml"} {
+		data, err := os.ReadFile(filepath.Join("testdata", "traffic", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &Configuration{
+		NodeCluster: "test",
+		NodeId:      "test",
+		AdminPort:   9000,
+		confDir:     dir,
+	}
+	cfg.Overload.Disable = true
+	return cfg, filepath.Join(dir, "listeners.yaml")
+}
+
+func TestShiftTraffic(t *testing.T) {
+	testCases := []struct {
+		name    string
+		route   string
+		weights map[string]int
+		old     string
+		new     string
+	}{
+		{
+			name:    "block mapping",
+			route:   "api",
+			weights: map[string]int{"api_v1": 50, "api_v2": 50},
+			old: `
+                          api_v1: 90
+                          api_v2: 10
+`,
+			new: `
+                          api_v1: 50
+                          api_v2: 50
+`,
+		},
+		{
+			name:    "block mapping changes clusters",
+			route:   "api",
+			weights: map[string]int{"api_v3": 100},
+			old: `
+                          api_v1: 90
+                          api_v2: 10
+`,
+			new: `
+                          api_v3: 100
+`,
+		},
+		{
+			name:    "flow mapping",
+			route:   "web",
+			weights: map[string]int{"api_v1": 20, "api_v3": 80},
+			old:     `clusters: { api_v1: 50, "api_v3": 50 } }`,
+			new:     `clusters: { api_v1: 20, api_v3: 80 } }`,
+		},
+		{
+			name:    "cluster shared with other routes",
+			route:   "admin",
+			weights: map[string]int{"api_v1": 30, "api_v2": 70},
+			old: `
+                        clusters:
+                          api_v1: 100
+                    - "!@@ weighted_route": # flow style
+`,
+			new: `
+                        clusters:
+                          api_v1: 30
+                          api_v2: 70
+                    - "!@@ weighted_route": # flow style
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, file := setupTrafficConf(t)
+			before, _ := os.ReadFile(file)
+			if !strings.Contains(string(before), tc.old) {
+				t.Fatalf("fixture does not contain %q", tc.old)
+			}
+
+			if err := ShiftTraffic(cfg, tc.route, tc.weights); err != nil {
+				t.Fatalf("ShiftTraffic: %v", err)
+			}
+
+			// Only the clusters mapping changes, comments, indentation
+			// and the other routes are kept byte by byte.
+			after, _ := os.ReadFile(file)
+			want := strings.Replace(string(before), tc.old, tc.new, 1)
+			if string(after) != want {
+				t.Errorf("listeners.yaml got:\n%s\nwant:\n%s", after, want)
+			}
+			if _, err := os.Stat(filepath.Join(cfg.OutputPath(), "listeners.yaml")); err != nil {
+				t.Errorf("configuration not regenerated: %v", err)
+			}
+		})
+	}
+}
+
+func TestShiftTrafficErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		route   string
+		weights map[string]int
+		// fixture replaces fixture[0] with fixture[1] in listeners.yaml.
+		fixture [2]string
+		errMsg  string
+	}{
+		{
+			name:    "weights not sum to 100",
+			route:   "api",
+			weights: map[string]int{"api_v1": 50, "api_v2": 40},
+			errMsg:  "sum to 90",
+		},
+		{
+			name:    "negative weight",
+			route:   "api",
+			weights: map[string]int{"api_v1": 110, "api_v2": -10},
+			errMsg:  "negative weight",
+		},
+		{
+			name:    "unknown route",
+			route:   "nonexistent",
+			weights: map[string]int{"api_v1": 100},
+			errMsg:  "not found",
+		},
+		{
+			name:    "unknown cluster",
+			route:   "api",
+			weights: map[string]int{"api_v1": 50, "api_v9": 50},
+			errMsg:  `"api_v9" is not defined`,
+		},
+		{
+			name:    "comments inside clusters",
+			route:   "commented",
+			weights: map[string]int{"api_v1": 100},
+			errMsg:  "comments inside clusters mapping",
+		},
+		{
+			name:    "empty clusters",
+			route:   "commented",
+			weights: map[string]int{"api_v1": 100},
+			fixture: [2]string{"clusters:\n                          api_v1: 100 # not supported", "clusters: {}"},
+			errMsg:  "clusters mapping is empty",
+		},
+		{
+			name:    "generate failure restores listeners.yaml",
+			route:   "api",
+			weights: map[string]int{"api_v1": 50, "api_v2": 50},
+			fixture: [2]string{`"127.0.0.1:10080"`, `"127.0.0.1:http-alt-x"`},
+			errMsg:  "address",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, file := setupTrafficConf(t)
+			if tc.fixture[0] != "" {
+				data, _ := os.ReadFile(file)
+				if !strings.Contains(string(data), tc.fixture[0]) {
+					t.Fatalf("fixture does not contain %q", tc.fixture[0])
+				}
+				data = []byte(strings.Replace(string(data), tc.fixture[0], tc.fixture[1], 1))
+				if err := os.WriteFile(file, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before, _ := os.ReadFile(file)
+
+			err := ShiftTraffic(cfg, tc.route, tc.weights)
+			if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+				t.Fatalf("ShiftTraffic got error %v, want %q", err, tc.errMsg)
+			}
+
+			after, _ := os.ReadFile(file)
+			if string(after) != string(before) {
+				t.Errorf("listeners.yaml is modified on error:\n%s", after)
+			}
+		})
+	}
+}
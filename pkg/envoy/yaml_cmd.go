@@ -2,9 +2,10 @@ package envoy
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
-	"github.com/spf13/cast"
+	"gopkg.in/yaml.v3"
 )
 
 const cmdPrefix = "!@@ "
@@ -26,14 +27,70 @@ func (p *YAMLParser) runCommand(cmd string, arg any) (any, error) {
 		return p.cmdEnvoyNode(arg)
 	case "envoy_admin":
 		return p.cmdEnvoyAdmin(arg)
+	case "envoy_stats":
+		return p.cmdEnvoyStats(arg)
+	case "overload_manager":
+		return p.cmdOverloadManager(arg)
+	case "prometheus_listener":
+		return p.cmdPrometheusListener(arg)
 	case "address":
 		return p.cmdAddress(arg)
 	case "sds_cluster":
 		return p.cmdSDSCluster(arg)
 	case "sds_tls":
 		return p.cmdDownstreamTlsContext(arg)
+	case "hcm":
+		return p.cmdHCM(arg)
+	case "proxy_protocol":
+		return p.cmdProxyProtocol(arg)
+	case "tcp_proxy":
+		return p.cmdTCPProxy(arg)
+	case "sni_passthrough":
+		return p.cmdSNIPassthrough(arg)
+	case "udp_proxy":
+		return p.cmdUDPProxy(arg)
+	case "access_log":
+		return p.cmdAccessLog(arg)
+	case "tcp_access_log":
+		return p.cmdTCPAccessLog(arg)
+	case "http_filters":
+		return p.cmdHTTPFilters(arg)
 	case "http_router":
 		return p.cmdHTTPRouter(arg)
+	case "http_cors":
+		return p.cmdHTTPCors(arg)
+	case "cors_policy":
+		return p.cmdCorsPolicy(arg)
+	case "http_compressor":
+		return p.cmdHTTPCompressor(arg)
+	case "http_local_ratelimit":
+		return p.cmdHTTPLocalRateLimit(arg)
+	case "http_health_check":
+		return p.cmdHTTPHealthCheck(arg)
+	case "http_buffer":
+		return p.cmdHTTPBuffer(arg)
+	case "http_lua":
+		return p.cmdHTTPLua(arg)
+	case "security_headers":
+		return p.cmdSecurityHeaders(arg)
+	case "http_basic_auth":
+		return p.cmdHTTPBasicAuth(arg)
+	case "basic_auth":
+		return p.cmdBasicAuth(arg)
+	case "ip_filter":
+		return p.cmdIPFilter(arg)
+	case "ext_authz":
+		return p.cmdExtAuthz(arg)
+	case "no_auth":
+		return p.cmdNoAuth(arg)
+	case "route":
+		return p.cmdRoute(arg)
+	case "fault":
+		return p.cmdHTTPFault(arg)
+	case "weighted_route":
+		return p.cmdWeightedRoute(arg)
+	case "mirror":
+		return p.cmdMirror(arg)
 	case "acme_challenge":
 		return p.cmdACMEChallenge(arg)
 	case "redirect_to_https":
@@ -44,13 +101,36 @@ func (p *YAMLParser) runCommand(cmd string, arg any) (any, error) {
 	return nil, fmt.Errorf("unknown command %q with arg %q", cmd, arg)
 }
 
+// cmdEnvoyNode generates the bootstrap node, metadata and locality are
+// rendered only if they are configured.
 func (p *YAMLParser) cmdEnvoyNode(arg any) (any, error) {
 	tmpl := `
 node:
   cluster: "{{ .NodeCluster }}"
   id: "{{ .NodeId }}"
 `
-	return p.parseYAML(tmpl, p.cfg)
+	result, err := p.parseYAML(tmpl, p.cfg)
+	if err != nil {
+		return nil, err
+	}
+	node := result.(map[string]any)["node"].(map[string]any)
+	if len(p.cfg.NodeMetadata) > 0 {
+		node["metadata"] = p.cfg.NodeMetadata
+	}
+	locality := map[string]any{}
+	if p.cfg.Locality.Region != "" {
+		locality["region"] = p.cfg.Locality.Region
+	}
+	if p.cfg.Locality.Zone != "" {
+		locality["zone"] = p.cfg.Locality.Zone
+	}
+	if p.cfg.Locality.SubZone != "" {
+		locality["sub_zone"] = p.cfg.Locality.SubZone
+	}
+	if len(locality) > 0 {
+		node["locality"] = locality
+	}
+	return result, nil
 }
 
 func (p *YAMLParser) cmdEnvoyAdmin(arg any) (any, error) {
@@ -64,99 +144,159 @@ admin:
 	return p.parseYAML(tmpl, p.cfg)
 }
 
+type addressArgs struct {
+	Address       string   `yaml:"address"`
+	Mode          fileMode `yaml:"mode"`
+	AllowHostname bool     `yaml:"allow_hostname"`
+}
+
+// fileMode is file permission bits, it accepts an octal YAML integer
+// like 0660, or an octal string like "0660".
+type fileMode uint32
+
+func (m *fileMode) UnmarshalYAML(value *yaml.Node) error {
+	var mode uint64
+	var err error
+	if value.Tag == "!!int" {
+		err = value.Decode(&mode)
+	} else {
+		mode, err = strconv.ParseUint(value.Value, 8, 32)
+	}
+	if err != nil || mode > 0777 {
+		return fmt.Errorf("invalid file mode %q", value.Value)
+	}
+	*m = fileMode(mode)
+	return nil
+}
+
+// cmdAddress accepts either an address string, or a mapping with
+// "address" and "mode", where mode is the file permission of
+// a unix domain socket, e.g. 0660.
+// See parseAddress for supported address formats.
+//
+// Listener and bind addresses must be IPs, a hostname is rejected unless
+// "allow_hostname" is true, e.g. for endpoints of DNS clusters.
 func (p *YAMLParser) cmdAddress(arg any) (any, error) {
-	s, ok := arg.(string)
-	if !ok {
-		return nil, fmt.Errorf("cmdAddress arg must be string, got %v", arg)
+	var args addressArgs
+	switch x := arg.(type) {
+	case string:
+		args.Address = x
+	case map[string]any:
+		if err := decodeArgs(x, &args); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("cmdAddress arg must be string or mapping, got %v", arg)
 	}
 
-	// Check unix domain socket.
-	if strings.HasPrefix(s, "unix:") {
-		pipePath := s[5:]
+	addr, err := parseAddress(args.Address)
+	if err != nil {
+		return nil, err
+	}
+	if addr.IsHostname && !args.AllowHostname {
+		return nil, fmt.Errorf("invalid address %q: %q is not an IP", args.Address, addr.Host)
+	}
+
+	if addr.IsPipe() {
+		pipe := map[string]any{
+			"path": addr.Pipe,
+		}
+		if args.Mode != 0 {
+			if addr.IsAbstract() {
+				return nil, fmt.Errorf("mode is not supported for abstract unix socket %q", args.Address)
+			}
+			pipe["mode"] = uint32(args.Mode)
+		}
 		return map[string]any{
 			"address": map[string]any{
-				"pipe": map[string]any{
-					"path": pipePath,
-				},
+				"pipe": pipe,
 			},
 		}, nil
 	}
 
-	// Else it should be an IP:PORT address, other types are not supported.
-	parts := strings.SplitN(s, ":", 2)
+	if args.Mode != 0 {
+		return nil, fmt.Errorf("mode is only supported for unix socket, got %q", args.Address)
+	}
+	socketAddr := map[string]any{
+		"address":    addr.Host,
+		"port_value": addr.Port,
+	}
+	if addr.Protocol != "" {
+		socketAddr["protocol"] = addr.Protocol
+	}
 	return map[string]any{
 		"address": map[string]any{
-			"socket_address": map[string]any{
-				"address":    parts[0],
-				"port_value": cast.ToInt(parts[1]),
-			},
+			"socket_address": socketAddr,
 		},
 	}, nil
 }
 
+// cmdSDSCluster generates the clusters of grpc mode SDS providers.
 func (p *YAMLParser) cmdSDSCluster(arg any) (any, error) {
-	if !p.cfg.SimpleSSL.Enable {
+	providers, err := p.cfg.getSDSProviders()
+	if err != nil {
+		return nil, err
+	}
+	var clusters []any
+	for _, sp := range providers {
+		if sp.Mode != sdsModeGRPC {
+			continue
+		}
+		cluster, err := sp.sdsCluster(p)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, cluster)
+	}
+	if len(clusters) == 0 {
 		return nil, nil
 	}
+	return clusters, nil
+}
 
-	tmpl := `
-name: sds_server_mtls
-typed_extension_protocol_options:
-  envoy.extensions.upstreams.http.v3.HttpProtocolOptions:
-    "@type": type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions
-    explicit_http_config:
-      http2_protocol_options:
-        connection_keepalive:
-          interval: 30s
-          timeout: 5s
-load_assignment:
-  cluster_name: sds_server_mtls
-  endpoints:
-    - lb_endpoints:
-        - endpoint:
-            "!@@ address": "{{ .SimpleSSL.SDSAddr }}"
-transport_socket:
-  name: envoy.transport_sockets.tls
-  typed_config:
-    "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext
-    common_tls_context:
-      tls_certificates:
-        - certificate_chain:
-            filename: "{{ .SimpleSSL.ClientCert }}"
-          private_key:
-            filename: "{{ .SimpleSSL.ClientKey }}"
-`
-	return p.parseYAML(tmpl, p.cfg)
+type downstreamTLSArgs struct {
+	Secret string `yaml:"secret"`
+	HTTP3  bool   `yaml:"http3"`
 }
 
+// cmdDownstreamTlsContext accepts either a secret reference, or a mapping
+// with "secret" and "http3". The secret is referenced as "provider:secret",
+// the provider can be omitted to use the default provider, see
+// Configuration.getSDSProvider.
+// When http3 is enabled, a companion QUIC listener is generated for
+// the filter chain, see addHTTP3Listeners.
 func (p *YAMLParser) cmdDownstreamTlsContext(arg any) (any, error) {
-	tmpl := `
-transport_socket:
-  name: envoy.transport_sockets.tls
-  typed_config:
-    "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.DownstreamTlsContext
-    common_tls_context:
-      tls_certificate_sds_secret_configs:
-        - name: "{{ . }}"
-          sds_config:
-            resource_api_version: V3
-            api_config_source:
-              api_type: GRPC
-              transport_api_version: V3
-              grpc_services:
-                envoy_grpc:
-                  cluster_name: sds_server_mtls
-`
-	return p.parseYAML(tmpl, arg)
-}
+	var args downstreamTLSArgs
+	if s, ok := arg.(string); ok {
+		args.Secret = s
+	} else if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.Secret == "" {
+		return nil, fmt.Errorf("sds_tls: secret is required")
+	}
+	provider, secret, err := p.cfg.getSDSProvider(args.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("sds_tls: %w", err)
+	}
+	commonTLSContext, err := provider.commonTLSContext(secret)
+	if err != nil {
+		return nil, fmt.Errorf("sds_tls: %w", err)
+	}
 
-func (p *YAMLParser) cmdHTTPRouter(arg any) (any, error) {
-	tmpl := `
-name: envoy.filters.http.router
-typed_config:
-  '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
-`
-	return p.parseYAML(tmpl)
+	result := map[string]any{
+		"transport_socket": map[string]any{
+			"name": "envoy.transport_sockets.tls",
+			"typed_config": map[string]any{
+				"@type":              "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.DownstreamTlsContext",
+				"common_tls_context": commonTLSContext,
+			},
+		},
+	}
+	if args.HTTP3 {
+		result[http3MarkerKey] = true
+	}
+	return result, nil
 }
 
 func (p *YAMLParser) cmdACMEChallenge(arg any) (any, error) {
@@ -169,34 +309,82 @@ match:
   prefix: "/.well-known/acme-challenge/"
 route:
   cluster: simplessl
+"!@@ no_auth":
 `
 	return p.parseYAML(tmpl)
 }
 
-func (p *YAMLParser) cmdRedirectToHTTPS(arg any) (any, error) {
-	tmpl := `
-match:
-  prefix: "/"
-redirect:
-  path_redirect: "/"
-  https_redirect: true
-`
-	return p.parseYAML(tmpl)
+type redirectToHTTPSArgs struct {
+	ResponseCode   int      `yaml:"response_code"`
+	Port           int      `yaml:"port"`
+	Host           string   `yaml:"host"`
+	ExemptPrefixes []string `yaml:"exempt_prefixes"`
+	ExemptCluster  string   `yaml:"exempt_cluster"`
 }
 
-func (p *YAMLParser) cmdSimpleCluster(arg any) (any, error) {
+var redirectResponseCodes = map[int]string{
+	301: "MOVED_PERMANENTLY",
+	302: "FOUND",
+	307: "TEMPORARY_REDIRECT",
+	308: "PERMANENT_REDIRECT",
+}
+
+// cmdRedirectToHTTPS generates a route which redirects requests to HTTPS,
+// the original path and query are preserved.
+//
+// Requests to exempt_prefixes are not redirected but routed to
+// exempt_cluster, in which case a list of routes is generated.
+func (p *YAMLParser) cmdRedirectToHTTPS(arg any) (any, error) {
+	var args redirectToHTTPSArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.ResponseCode == 0 {
+		args.ResponseCode = 301
+	}
+	responseCode, ok := redirectResponseCodes[args.ResponseCode]
+	if !ok {
+		return nil, fmt.Errorf("redirect_to_https: unsupported response_code %d", args.ResponseCode)
+	}
+	if args.Port < 0 || args.Port > 65535 {
+		return nil, fmt.Errorf("redirect_to_https: invalid port %d", args.Port)
+	}
+	if len(args.ExemptPrefixes) > 0 && args.ExemptCluster == "" {
+		return nil, fmt.Errorf("redirect_to_https: exempt_cluster is required for exempt_prefixes")
+	}
+
 	tmpl := `
-name: "{{ .name }}"
-'@type': type.googleapis.com/envoy.config.cluster.v3.Cluster
-connect_timeout: 1s
-load_assignment:
-  cluster_name: "{{ .name }}"
-  endpoints:
-    - lb_endpoints:
-      {{ range .endpoints }}
-      - endpoint:
-          "!@@ address": {{ . }}
-      {{- end }}
+{{- range .ExemptPrefixes }}
+- match:
+    prefix: "{{ . }}"
+  route:
+    cluster: "{{ $.ExemptCluster }}"
+{{- end }}
+- match:
+    prefix: "/"
+  redirect:
+    https_redirect: true
+    response_code: {{ .responseCode }}
+    {{- if .Port }}
+    port_redirect: {{ .Port }}
+    {{- end }}
+    {{- if .Host }}
+    host_redirect: "{{ .Host }}"
+    {{- end }}
 `
-	return p.parseYAML(tmpl, arg)
+	result, err := p.parseYAML(tmpl, map[string]any{
+		"ExemptPrefixes": args.ExemptPrefixes,
+		"ExemptCluster":  args.ExemptCluster,
+		"Port":           args.Port,
+		"Host":           args.Host,
+		"responseCode":   responseCode,
+	})
+	if err != nil {
+		return nil, err
+	}
+	routes := result.([]any)
+	if len(routes) == 1 {
+		return routes[0], nil
+	}
+	return routes, nil
 }
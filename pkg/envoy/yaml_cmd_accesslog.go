@@ -0,0 +1,281 @@
+package envoy
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/jxskiss/gopkg/v2/easy"
+)
+
+// defaultAccessLogJSONFields is the default field set of JSON format
+// access logs.
+var defaultAccessLogJSONFields = map[string]any{
+	"start_time":                "%START_TIME%",
+	"method":                    "%REQ(:METHOD)%",
+	"authority":                 "%REQ(:AUTHORITY)%",
+	"path":                      "%REQ(X-ENVOY-ORIGINAL-PATH?:PATH)%",
+	"protocol":                  "%PROTOCOL%",
+	"response_code":             "%RESPONSE_CODE%",
+	"response_flags":            "%RESPONSE_FLAGS%",
+	"bytes_received":            "%BYTES_RECEIVED%",
+	"bytes_sent":                "%BYTES_SENT%",
+	"duration":                  "%DURATION%",
+	"upstream_service_time":     "%RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)%",
+	"upstream_cluster":          "%UPSTREAM_CLUSTER%",
+	"upstream_host":             "%UPSTREAM_HOST%",
+	"downstream_remote_address": "%DOWNSTREAM_REMOTE_ADDRESS%",
+	"x_forwarded_for":           "%REQ(X-FORWARDED-FOR)%",
+	"user_agent":                "%REQ(USER-AGENT)%",
+	"request_id":                "%REQ(X-REQUEST-ID)%",
+}
+
+// defaultTCPAccessLogJSONFields is the default field set of JSON format
+// access logs of network filters, e.g. tcp_proxy, which don't have
+// HTTP requests and responses.
+var defaultTCPAccessLogJSONFields = map[string]any{
+	"start_time":                        "%START_TIME%",
+	"duration":                          "%DURATION%",
+	"bytes_received":                    "%BYTES_RECEIVED%",
+	"bytes_sent":                        "%BYTES_SENT%",
+	"response_flags":                    "%RESPONSE_FLAGS%",
+	"upstream_cluster":                  "%UPSTREAM_CLUSTER%",
+	"upstream_host":                     "%UPSTREAM_HOST%",
+	"upstream_transport_failure_reason": "%UPSTREAM_TRANSPORT_FAILURE_REASON%",
+	"downstream_remote_address":         "%DOWNSTREAM_REMOTE_ADDRESS%",
+	"downstream_local_address":          "%DOWNSTREAM_LOCAL_ADDRESS%",
+	"requested_server_name":             "%REQUESTED_SERVER_NAME%",
+	"connection_termination_details":    "%CONNECTION_TERMINATION_DETAILS%",
+}
+
+// defaultTCPAccessLogTextFormat is the default text format of access logs
+// of network filters, Envoy's default format is for HTTP.
+const defaultTCPAccessLogTextFormat = "[%START_TIME%] %DOWNSTREAM_REMOTE_ADDRESS% -> " +
+	"%UPSTREAM_HOST% %UPSTREAM_CLUSTER% %REQUESTED_SERVER_NAME% " +
+	"%BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESPONSE_FLAGS% " +
+	"%CONNECTION_TERMINATION_DETAILS%\n"
+
+type accessLogArgs struct {
+	Sink       string            `yaml:"sink"`
+	Path       string            `yaml:"path"`
+	Format     string            `yaml:"format"`
+	TextFormat string            `yaml:"text_format"`
+	Fields     map[string]string `yaml:"fields"`
+	Filter     *accessLogFilter  `yaml:"filter"`
+}
+
+type accessLogFilter struct {
+	StatusCodeMin int      `yaml:"status_code_min"`
+	DurationMin   duration `yaml:"duration_min"`
+	SamplePercent int      `yaml:"sample_percent"`
+}
+
+// cmdAccessLog generates an access log configuration.
+//
+// sink is one of "stdout" (default), "stderr" and "file", a relative path
+// of file sink is placed under the configured access log directory.
+// format is one of "text" (default) and "json", JSON logs use
+// a curated default field set unless fields is specified.
+func (p *YAMLParser) cmdAccessLog(arg any) (any, error) {
+	return p.accessLog(arg, false)
+}
+
+// cmdTCPAccessLog generates an access log configuration for network
+// filters, e.g. tcp_proxy. It accepts the same options as the
+// "access_log" command, but defaults to a format of connection fields
+// (bytes, duration, upstream host and termination details), and
+// status_code_min is not supported.
+func (p *YAMLParser) cmdTCPAccessLog(arg any) (any, error) {
+	return p.accessLog(arg, true)
+}
+
+func (p *YAMLParser) accessLog(arg any, tcp bool) (any, error) {
+	var args accessLogArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.Sink == "" {
+		args.Sink = "stdout"
+	}
+	if args.Format == "" {
+		args.Format = "text"
+	}
+
+	var logFormat map[string]any
+	switch args.Format {
+	case "text":
+		if len(args.Fields) > 0 {
+			return nil, fmt.Errorf("access_log: fields is only supported for json format")
+		}
+		if args.TextFormat == "" && tcp {
+			args.TextFormat = defaultTCPAccessLogTextFormat
+		}
+		if args.TextFormat != "" {
+			logFormat = map[string]any{
+				"text_format_source": map[string]any{
+					"inline_string": args.TextFormat,
+				},
+			}
+		}
+	case "json":
+		if args.TextFormat != "" {
+			return nil, fmt.Errorf("access_log: text_format is only supported for text format")
+		}
+		fields := make(map[string]any)
+		if len(args.Fields) > 0 {
+			for k, v := range args.Fields {
+				fields[k] = v
+			}
+		} else if tcp {
+			easy.MergeMapsTo(fields, defaultTCPAccessLogJSONFields)
+		} else {
+			easy.MergeMapsTo(fields, defaultAccessLogJSONFields)
+		}
+		logFormat = map[string]any{
+			"json_format": fields,
+		}
+	default:
+		return nil, fmt.Errorf("access_log: unsupported format %q", args.Format)
+	}
+
+	var name string
+	typedConfig := map[string]any{}
+	switch args.Sink {
+	case "stdout":
+		name = "envoy.access_loggers.stdout"
+		typedConfig["@type"] = "type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog"
+	case "stderr":
+		name = "envoy.access_loggers.stderr"
+		typedConfig["@type"] = "type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StderrAccessLog"
+	case "file":
+		path := p.accessLogPath(args.Path)
+		name = "envoy.access_loggers.file"
+		typedConfig["@type"] = "type.googleapis.com/envoy.extensions.access_loggers.file.v3.FileAccessLog"
+		typedConfig["path"] = path
+		p.accessLogDirs = append(p.accessLogDirs, filepath.Dir(path))
+	default:
+		return nil, fmt.Errorf("access_log: unsupported sink %q", args.Sink)
+	}
+	if args.Sink != "file" && args.Path != "" {
+		return nil, fmt.Errorf("access_log: path is only supported for file sink")
+	}
+	if logFormat != nil {
+		typedConfig["log_format"] = logFormat
+	}
+
+	accessLog := map[string]any{
+		"name":         name,
+		"typed_config": typedConfig,
+	}
+	if args.Filter != nil {
+		if tcp && args.Filter.StatusCodeMin > 0 {
+			return nil, fmt.Errorf("access_log: status_code_min is not supported by network filters")
+		}
+		filter, err := args.Filter.build()
+		if err != nil {
+			return nil, fmt.Errorf("access_log: %w", err)
+		}
+		if filter != nil {
+			accessLog["filter"] = filter
+		}
+	}
+	return accessLog, nil
+}
+
+// accessLogPath returns path of a file access log, relative paths are
+// placed under the access log directory.
+func (p *YAMLParser) accessLogPath(path string) string {
+	if path == "" {
+		path = "access.log"
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.cfg.AccessLog.LogDir, path)
+	}
+	return path
+}
+
+func (f *accessLogFilter) build() (map[string]any, error) {
+	var filters []any
+	if f.StatusCodeMin > 0 {
+		filters = append(filters, map[string]any{
+			"status_code_filter": map[string]any{
+				"comparison": map[string]any{
+					"op": "GE",
+					"value": map[string]any{
+						"default_value": f.StatusCodeMin,
+						"runtime_key":   "access_log.status_code_min",
+					},
+				},
+			},
+		})
+	}
+	if f.DurationMin > 0 {
+		filters = append(filters, map[string]any{
+			"duration_filter": map[string]any{
+				"comparison": map[string]any{
+					"op": "GE",
+					"value": map[string]any{
+						"default_value": time.Duration(f.DurationMin).Milliseconds(),
+						"runtime_key":   "access_log.duration_min",
+					},
+				},
+			},
+		})
+	}
+	if f.SamplePercent != 0 {
+		if f.SamplePercent < 0 || f.SamplePercent > 100 {
+			return nil, fmt.Errorf("sample_percent must be in range [0, 100], got %d", f.SamplePercent)
+		}
+		filters = append(filters, map[string]any{
+			"runtime_filter": map[string]any{
+				"runtime_key": "access_log.sample_percent",
+				"percent_sampled": map[string]any{
+					"numerator":   f.SamplePercent,
+					"denominator": "HUNDRED",
+				},
+			},
+		})
+	}
+	switch len(filters) {
+	case 0:
+		return nil, nil
+	case 1:
+		return filters[0].(map[string]any), nil
+	}
+	return map[string]any{
+		"and_filter": map[string]any{
+			"filters": filters,
+		},
+	}, nil
+}
+
+// defaultAccessLogs returns the default access logs configured in envoy.yaml,
+// it returns nil if there is no default access log.
+// If tcp is true, the access log is generated for network filters by the
+// "tcp_access_log" command, and status_code_min of filter is ignored.
+func (p *YAMLParser) defaultAccessLogs(tcp bool) []any {
+	if p.cfg.AccessLog.Default == nil {
+		return nil
+	}
+	cmd, args := "access_log", p.cfg.AccessLog.Default
+	if tcp {
+		cmd, args = "tcp_access_log", make(map[string]any, len(args))
+		for k, v := range p.cfg.AccessLog.Default {
+			args[k] = v
+		}
+		if filter, ok := args["filter"].(map[string]any); ok {
+			tcpFilter := make(map[string]any, len(filter))
+			for k, v := range filter {
+				if k != "status_code_min" {
+					tcpFilter[k] = v
+				}
+			}
+			args["filter"] = tcpFilter
+		}
+	}
+	return []any{
+		map[string]any{
+			cmdPrefix + cmd: args,
+		},
+	}
+}
@@ -0,0 +1,105 @@
+package envoy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTCPAccessLogDefaults(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		want    []string
+		notWant []string
+		wantErr bool
+	}{
+		{
+			name:    "json",
+			input:   `{"!@@ tcp_access_log": {format: json}}`,
+			want:    []string{"%BYTES_SENT%", "%UPSTREAM_HOST%", "%CONNECTION_TERMINATION_DETAILS%"},
+			notWant: []string{"%REQ(", "%RESPONSE_CODE%"},
+		},
+		{
+			name:    "text",
+			input:   `{"!@@ tcp_access_log": {}}`,
+			want:    []string{"text_format_source", "%DURATION%", "%CONNECTION_TERMINATION_DETAILS%"},
+			notWant: []string{"%REQ(", "%RESPONSE_CODE%"},
+		},
+		{
+			name:    "custom fields",
+			input:   `{"!@@ tcp_access_log": {format: json, fields: {bytes: "%BYTES_SENT%"}}}`,
+			want:    []string{"bytes:%BYTES_SENT%"},
+			notWant: []string{"%UPSTREAM_HOST%"},
+		},
+		{
+			name:    "status code filter",
+			input:   `{"!@@ tcp_access_log": {filter: {status_code_min: 500}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "http json",
+			input:   `{"!@@ access_log": {format: json}}`,
+			want:    []string{"%REQ(:METHOD)%", "%RESPONSE_CODE%"},
+			notWant: []string{"%CONNECTION_TERMINATION_DETAILS%"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &YAMLParser{cfg: &Configuration{}}
+			got, err := p.solveCommands("test", mustParseYAML(t, tc.input))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("solveCommands: %v", err)
+			}
+			out := fmt.Sprint(got)
+			for _, s := range tc.want {
+				if !strings.Contains(out, s) {
+					t.Errorf("access log does not contain %q: %s", s, out)
+				}
+			}
+			for _, s := range tc.notWant {
+				if strings.Contains(out, s) {
+					t.Errorf("access log contains %q: %s", s, out)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultAccessLogOfNetworkFilters(t *testing.T) {
+	cfg := &Configuration{}
+	cfg.AccessLog.Default = map[string]any{
+		"format": "json",
+		"filter": map[string]any{"status_code_min": 500, "sample_percent": 10},
+	}
+	p := &YAMLParser{cfg: cfg}
+	input := mustParseYAML(t, `
+- "!@@ tcp_proxy": { cluster: backend }
+- "!@@ hcm": { stat_prefix: ingress_http, virtual_hosts: [{ name: default, domains: ["*"], routes: [] }] }
+`)
+	got, err := p.solveCommands("test", input)
+	if err != nil {
+		t.Fatalf("solveCommands: %v", err)
+	}
+	filters := got.([]any)
+	tcpLog := fmt.Sprint(filters[0])
+	if !strings.Contains(tcpLog, "%CONNECTION_TERMINATION_DETAILS%") || strings.Contains(tcpLog, "%REQ(") {
+		t.Errorf("tcp_proxy access log got %s", tcpLog)
+	}
+	if strings.Contains(tcpLog, "status_code_filter") || !strings.Contains(tcpLog, "runtime_filter") {
+		t.Errorf("tcp_proxy access log filter got %s", tcpLog)
+	}
+	httpLog := fmt.Sprint(filters[1])
+	if !strings.Contains(httpLog, "%REQ(:METHOD)%") || !strings.Contains(httpLog, "status_code_filter") {
+		t.Errorf("hcm access log got %s", httpLog)
+	}
+	if _, ok := cfg.AccessLog.Default["filter"].(map[string]any)["status_code_min"]; !ok {
+		t.Errorf("default access log config is modified")
+	}
+}
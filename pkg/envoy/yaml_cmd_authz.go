@@ -0,0 +1,144 @@
+package envoy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const extAuthzFilterName = "envoy.filters.http.ext_authz"
+
+type extAuthzArgs struct {
+	Cluster          string   `yaml:"cluster"`
+	Type             string   `yaml:"type"`
+	Timeout          duration `yaml:"timeout"`
+	PathPrefix       string   `yaml:"path_prefix"`
+	FailureModeAllow bool     `yaml:"failure_mode_allow"`
+	StatusOnError    int      `yaml:"status_on_error"`
+
+	// AllowedHeaders are the request headers forwarded to the
+	// authorization service, in addition to the headers Envoy always sends
+	// (Host, Method, Path, Content-Length and Authorization).
+	AllowedHeaders []string `yaml:"allowed_headers"`
+
+	// UpstreamHeaders are the authorization response headers added to
+	// the upstream request, ClientHeaders are the authorization response
+	// headers sent to the client when a request is denied.
+	// They are only supported by the HTTP authorization service.
+	UpstreamHeaders []string `yaml:"upstream_headers"`
+	ClientHeaders   []string `yaml:"client_headers"`
+
+	MaxRequestBytes int `yaml:"max_request_bytes"`
+}
+
+// cmdExtAuthz generates an envoy.filters.http.ext_authz HTTP filter, which
+// checks requests against an HTTP or gRPC authorization service.
+// The cluster can be defined by the "simple_cluster" command, a gRPC
+// cluster requires "http2: true".
+//
+// type is either "http" (default) or "grpc".
+// If timeout is not specified, it defaults to 250ms.
+// If max_request_bytes is specified, the request body is buffered and
+// sent to the authorization service.
+//
+// Use the "no_auth" command to disable it on virtual hosts or routes.
+func (p *YAMLParser) cmdExtAuthz(arg any) (any, error) {
+	var args extAuthzArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.Cluster == "" {
+		return nil, fmt.Errorf("ext_authz: cluster is required")
+	}
+	if args.Type == "" {
+		args.Type = "http"
+	}
+	if args.Timeout == 0 {
+		args.Timeout = duration(250 * time.Millisecond)
+	}
+
+	config := map[string]any{
+		"@type":                 "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthz",
+		"transport_api_version": "V3",
+		"failure_mode_allow":    args.FailureModeAllow,
+	}
+	switch strings.ToLower(args.Type) {
+	case "http":
+		service := map[string]any{
+			"server_uri": map[string]any{
+				"uri":     "http://" + args.Cluster,
+				"cluster": args.Cluster,
+				"timeout": args.Timeout.String(),
+			},
+		}
+		if args.PathPrefix != "" {
+			service["path_prefix"] = args.PathPrefix
+		}
+		authzResponse := map[string]any{}
+		if len(args.UpstreamHeaders) > 0 {
+			authzResponse["allowed_upstream_headers"] = stringMatchers(args.UpstreamHeaders)
+		}
+		if len(args.ClientHeaders) > 0 {
+			authzResponse["allowed_client_headers"] = stringMatchers(args.ClientHeaders)
+		}
+		if len(authzResponse) > 0 {
+			service["authorization_response"] = authzResponse
+		}
+		config["http_service"] = service
+	case "grpc":
+		if args.PathPrefix != "" || len(args.UpstreamHeaders) > 0 || len(args.ClientHeaders) > 0 {
+			return nil, fmt.Errorf("ext_authz: path_prefix, upstream_headers and client_headers are not supported by grpc service")
+		}
+		config["grpc_service"] = map[string]any{
+			"envoy_grpc": map[string]any{
+				"cluster_name": args.Cluster,
+			},
+			"timeout": args.Timeout.String(),
+		}
+	default:
+		return nil, fmt.Errorf("ext_authz: unsupported type %q", args.Type)
+	}
+	if len(args.AllowedHeaders) > 0 {
+		config["allowed_headers"] = stringMatchers(args.AllowedHeaders)
+	}
+	if args.StatusOnError > 0 {
+		config["status_on_error"] = map[string]any{"code": args.StatusOnError}
+	}
+	if args.MaxRequestBytes > 0 {
+		config["with_request_body"] = map[string]any{
+			"max_request_bytes":     args.MaxRequestBytes,
+			"allow_partial_message": true,
+		}
+	}
+	return map[string]any{
+		"name":         extAuthzFilterName,
+		"typed_config": config,
+	}, nil
+}
+
+// cmdNoAuth disables ext_authz and basic_auth on a virtual host or route,
+// e.g. for health check and ACME challenge paths.
+func (p *YAMLParser) cmdNoAuth(arg any) (any, error) {
+	disabled := map[string]any{
+		"@type":       "type.googleapis.com/envoy.config.route.v3.FilterConfig",
+		"disabled":    true,
+		"is_optional": true,
+	}
+	return map[string]any{
+		"typed_per_filter_config": map[string]any{
+			extAuthzFilterName:  disabled,
+			basicAuthFilterName: disabled,
+		},
+	}, nil
+}
+
+func stringMatchers(values []string) map[string]any {
+	patterns := make([]any, 0, len(values))
+	for _, v := range values {
+		patterns = append(patterns, map[string]any{
+			"exact":       v,
+			"ignore_case": true,
+		})
+	}
+	return map[string]any{"patterns": patterns}
+}
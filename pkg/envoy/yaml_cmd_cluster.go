@@ -0,0 +1,387 @@
+package envoy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type simpleClusterArgs struct {
+	Name             string                `yaml:"name"`
+	Type             string                `yaml:"type"`
+	LbPolicy         string                `yaml:"lb_policy"`
+	ConnectTimeout   duration              `yaml:"connect_timeout"`
+	Protocol         string                `yaml:"protocol"`
+	HTTP2            bool                  `yaml:"http2"`
+	Endpoints        []clusterEndpoint     `yaml:"endpoints"`
+	HealthCheck      *healthCheckArgs      `yaml:"health_check"`
+	CircuitBreakers  *circuitBreakersArgs  `yaml:"circuit_breakers"`
+	OutlierDetection *outlierDetectionArgs `yaml:"outlier_detection"`
+	TLS              *upstreamTLSArgs      `yaml:"tls"`
+	ProxyProtocol    string                `yaml:"proxy_protocol"`
+}
+
+// clusterEndpoint is an endpoint of a cluster, it can be written as
+// an address string, or a mapping with "address" and "weight".
+type clusterEndpoint struct {
+	Address string `yaml:"address"`
+	Weight  int    `yaml:"weight"`
+}
+
+func (e *clusterEndpoint) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		e.Address = value.Value
+		return nil
+	}
+	type plain clusterEndpoint
+	return value.Decode((*plain)(e))
+}
+
+type healthCheckArgs struct {
+	Path               string   `yaml:"path"`
+	Host               string   `yaml:"host"`
+	Interval           duration `yaml:"interval"`
+	Timeout            duration `yaml:"timeout"`
+	HealthyThreshold   int      `yaml:"healthy_threshold"`
+	UnhealthyThreshold int      `yaml:"unhealthy_threshold"`
+}
+
+type circuitBreakersArgs struct {
+	MaxConnections     int `yaml:"max_connections"`
+	MaxPendingRequests int `yaml:"max_pending_requests"`
+	MaxRequests        int `yaml:"max_requests"`
+	MaxRetries         int `yaml:"max_retries"`
+}
+
+type outlierDetectionArgs struct {
+	Consecutive5xx     int      `yaml:"consecutive_5xx"`
+	Interval           duration `yaml:"interval"`
+	BaseEjectionTime   duration `yaml:"base_ejection_time"`
+	MaxEjectionPercent int      `yaml:"max_ejection_percent"`
+}
+
+var (
+	clusterDiscoveryTypes = map[string]string{
+		"static":      "STATIC",
+		"strict_dns":  "STRICT_DNS",
+		"logical_dns": "LOGICAL_DNS",
+		"eds":         "EDS",
+	}
+	clusterLbPolicies = map[string]string{
+		"round_robin":   "ROUND_ROBIN",
+		"least_request": "LEAST_REQUEST",
+		"random":        "RANDOM",
+		"ring_hash":     "RING_HASH",
+		"maglev":        "MAGLEV",
+	}
+)
+
+func (a *simpleClusterArgs) normalize() error {
+	if a.Name == "" {
+		return fmt.Errorf("simple_cluster: name is required")
+	}
+	if a.Type != "" {
+		typ, ok := clusterDiscoveryTypes[strings.ToLower(a.Type)]
+		if !ok {
+			return fmt.Errorf("simple_cluster %s: unsupported type %q", a.Name, a.Type)
+		}
+		a.Type = typ
+	}
+	if len(a.Endpoints) == 0 && a.Type != "EDS" {
+		return fmt.Errorf("simple_cluster %s: endpoints is required", a.Name)
+	}
+	isDNS := a.Type == "STRICT_DNS" || a.Type == "LOGICAL_DNS"
+	if a.Type == "LOGICAL_DNS" && len(a.Endpoints) > 1 {
+		return fmt.Errorf("simple_cluster %s: logical_dns cluster must have exactly one endpoint", a.Name)
+	}
+	for _, ep := range a.Endpoints {
+		addr, err := parseAddress(ep.Address)
+		if err != nil {
+			return fmt.Errorf("simple_cluster %s: %w", a.Name, err)
+		}
+		if addr.IsHostname && !isDNS {
+			return fmt.Errorf("simple_cluster %s: endpoint %q is a hostname, which requires type strict_dns or logical_dns", a.Name, ep.Address)
+		}
+		if addr.IsPipe() && isDNS {
+			return fmt.Errorf("simple_cluster %s: unix socket endpoint %q cannot be used in DNS cluster", a.Name, ep.Address)
+		}
+	}
+	if a.LbPolicy != "" {
+		policy, ok := clusterLbPolicies[strings.ToLower(a.LbPolicy)]
+		if !ok {
+			return fmt.Errorf("simple_cluster %s: unsupported lb_policy %q", a.Name, a.LbPolicy)
+		}
+		a.LbPolicy = policy
+	}
+	if a.ConnectTimeout == 0 {
+		a.ConnectTimeout = duration(time.Second)
+	}
+	if a.HTTP2 {
+		if a.Protocol != "" && a.Protocol != "http2" {
+			return fmt.Errorf("simple_cluster %s: http2 conflicts with protocol %q", a.Name, a.Protocol)
+		}
+		a.Protocol = "http2"
+	}
+	switch a.Protocol {
+	case "", "http1", "http2", "auto":
+	default:
+		return fmt.Errorf("simple_cluster %s: unsupported protocol %q", a.Name, a.Protocol)
+	}
+	if hc := a.HealthCheck; hc != nil {
+		if hc.Interval == 0 {
+			hc.Interval = duration(5 * time.Second)
+		}
+		if hc.Timeout == 0 {
+			hc.Timeout = duration(time.Second)
+		}
+		if hc.HealthyThreshold == 0 {
+			hc.HealthyThreshold = 2
+		}
+		if hc.UnhealthyThreshold == 0 {
+			hc.UnhealthyThreshold = 3
+		}
+	}
+	switch strings.ToLower(a.ProxyProtocol) {
+	case "", "v1", "v2":
+		a.ProxyProtocol = strings.ToUpper(a.ProxyProtocol)
+	default:
+		return fmt.Errorf("simple_cluster %s: unsupported proxy_protocol version %q", a.Name, a.ProxyProtocol)
+	}
+	if od := a.OutlierDetection; od != nil && od.Consecutive5xx == 0 {
+		od.Consecutive5xx = 5
+	}
+	return nil
+}
+
+// cmdSimpleCluster generates a cluster with the commonly used options.
+//
+// If type is "eds", the endpoints are loaded from the file
+// "generated/endpoints/<name>.yaml" by file-based EDS, which is managed
+// by the "envoy endpoints" command, the endpoints in the arg are only
+// used to create the file if it does not exist.
+func (p *YAMLParser) cmdSimpleCluster(arg any) (any, error) {
+	var args simpleClusterArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if err := args.normalize(); err != nil {
+		return nil, err
+	}
+
+	tmpl := `
+name: "{{ .Name }}"
+'@type': type.googleapis.com/envoy.config.cluster.v3.Cluster
+{{- if .Type }}
+type: {{ .Type }}
+{{- end }}
+{{- if .LbPolicy }}
+lb_policy: {{ .LbPolicy }}
+{{- end }}
+connect_timeout: {{ .ConnectTimeout }}
+{{- if and .Protocol (ne .Protocol "http1") }}
+typed_extension_protocol_options:
+  envoy.extensions.upstreams.http.v3.HttpProtocolOptions:
+    "@type": type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions
+    {{- if eq .Protocol "http2" }}
+    explicit_http_config:
+      http2_protocol_options: {}
+    {{- else }}
+    auto_config:
+      http_protocol_options: {}
+      http2_protocol_options: {}
+    {{- end }}
+{{- end }}
+{{- if ne .Type "EDS" }}
+load_assignment:
+  cluster_name: "{{ .Name }}"
+  endpoints:
+    - lb_endpoints:
+      {{- range .Endpoints }}
+      - endpoint:
+          "!@@ address": { address: "{{ .Address }}", allow_hostname: true }
+        {{- if .Weight }}
+        load_balancing_weight: {{ .Weight }}
+        {{- end }}
+      {{- end }}
+{{- end }}
+{{- with .HealthCheck }}
+health_checks:
+  - interval: {{ .Interval }}
+    timeout: {{ .Timeout }}
+    healthy_threshold: {{ .HealthyThreshold }}
+    unhealthy_threshold: {{ .UnhealthyThreshold }}
+    {{- if .Path }}
+    http_health_check:
+      path: "{{ .Path }}"
+      {{- if .Host }}
+      host: "{{ .Host }}"
+      {{- end }}
+    {{- else }}
+    tcp_health_check: {}
+    {{- end }}
+{{- end }}
+{{- with .CircuitBreakers }}
+circuit_breakers:
+  thresholds:
+    - priority: DEFAULT
+      {{- if .MaxConnections }}
+      max_connections: {{ .MaxConnections }}
+      {{- end }}
+      {{- if .MaxPendingRequests }}
+      max_pending_requests: {{ .MaxPendingRequests }}
+      {{- end }}
+      {{- if .MaxRequests }}
+      max_requests: {{ .MaxRequests }}
+      {{- end }}
+      {{- if .MaxRetries }}
+      max_retries: {{ .MaxRetries }}
+      {{- end }}
+{{- end }}
+{{- with .OutlierDetection }}
+outlier_detection:
+  {{- if .Consecutive5xx }}
+  consecutive_5xx: {{ .Consecutive5xx }}
+  {{- end }}
+  {{- if .Interval }}
+  interval: {{ .Interval }}
+  {{- end }}
+  {{- if .BaseEjectionTime }}
+  base_ejection_time: {{ .BaseEjectionTime }}
+  {{- end }}
+  {{- if .MaxEjectionPercent }}
+  max_ejection_percent: {{ .MaxEjectionPercent }}
+  {{- end }}
+{{- end }}
+`
+	result, err := p.parseYAML(tmpl, args)
+	if err != nil {
+		return nil, err
+	}
+	cluster := result.(map[string]any)
+	if args.Type == "EDS" {
+		cluster["eds_cluster_config"] = edsClusterConfig(p.cfg.EndpointsPath(), args.Name)
+		if p.edsSeeds == nil {
+			p.edsSeeds = make(map[string][]Endpoint)
+		}
+		seeds := make([]Endpoint, 0, len(args.Endpoints))
+		for _, ep := range args.Endpoints {
+			seeds = append(seeds, Endpoint{Address: ep.Address, Weight: ep.Weight})
+		}
+		p.edsSeeds[args.Name] = seeds
+	}
+
+	var transportSocket any
+	if args.TLS != nil {
+		transportSocket, err = p.upstreamTransportSocket(args.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("simple_cluster %s: %w", args.Name, err)
+		}
+	}
+	if args.ProxyProtocol != "" {
+		transportSocket = proxyProtocolTransportSocket(args.ProxyProtocol, transportSocket)
+	}
+	if transportSocket != nil {
+		cluster["transport_socket"] = transportSocket
+	}
+	return cluster, nil
+}
+
+// proxyProtocolTransportSocket wraps transportSocket to send PROXY protocol
+// header to upstream hosts, if transportSocket is nil, raw buffer is used.
+func proxyProtocolTransportSocket(version string, transportSocket any) any {
+	if transportSocket == nil {
+		transportSocket = map[string]any{
+			"name": "envoy.transport_sockets.raw_buffer",
+			"typed_config": map[string]any{
+				"@type": "type.googleapis.com/envoy.extensions.transport_sockets.raw_buffer.v3.RawBuffer",
+			},
+		}
+	}
+	return map[string]any{
+		"name": "envoy.transport_sockets.upstream_proxy_protocol",
+		"typed_config": map[string]any{
+			"@type": "type.googleapis.com/envoy.extensions.transport_sockets.proxy_protocol.v3.ProxyProtocolUpstreamTransport",
+			"config": map[string]any{
+				"version": version,
+			},
+			"transport_socket": transportSocket,
+		},
+	}
+}
+
+// upstreamTLSArgs configures the TLS connection to upstream hosts.
+//
+// It can be written as a mapping, or simply "tls: true" to enable TLS
+// without verifying the upstream certificate.
+type upstreamTLSArgs struct {
+	SNI       string   `yaml:"sni"`
+	CA        string   `yaml:"ca"`
+	Cert      string   `yaml:"cert"`
+	Key       string   `yaml:"key"`
+	VerifySAN []string `yaml:"verify_san"`
+}
+
+func (a *upstreamTLSArgs) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		var enable bool
+		if err := value.Decode(&enable); err != nil {
+			return fmt.Errorf("tls must be a bool or a mapping, got %q", value.Value)
+		}
+		if !enable {
+			return fmt.Errorf("tls: false is not supported, remove the option instead")
+		}
+		return nil
+	}
+	type plain upstreamTLSArgs
+	return value.Decode((*plain)(a))
+}
+
+func (a *upstreamTLSArgs) validate() error {
+	if (a.Cert == "") != (a.Key == "") {
+		return fmt.Errorf("tls: cert and key must be specified together")
+	}
+	if len(a.VerifySAN) > 0 && a.CA == "" {
+		return fmt.Errorf("tls: verify_san requires ca to be specified")
+	}
+	return nil
+}
+
+func (p *YAMLParser) upstreamTransportSocket(args *upstreamTLSArgs) (any, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+
+	tmpl := `
+name: envoy.transport_sockets.tls
+typed_config:
+  "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext
+  {{- if .SNI }}
+  sni: "{{ .SNI }}"
+  {{- end }}
+  common_tls_context:
+    {{- if not (or .Cert .CA) }} {}{{ end }}
+    {{- if .Cert }}
+    tls_certificates:
+      - certificate_chain:
+          filename: "{{ .Cert }}"
+        private_key:
+          filename: "{{ .Key }}"
+    {{- end }}
+    {{- if .CA }}
+    validation_context:
+      trusted_ca:
+        filename: "{{ .CA }}"
+      {{- if .VerifySAN }}
+      match_typed_subject_alt_names:
+        {{- range .VerifySAN }}
+        - san_type: DNS
+          matcher:
+            exact: "{{ . }}"
+        {{- end }}
+      {{- end }}
+    {{- end }}
+`
+	return p.parseYAML(tmpl, args)
+}
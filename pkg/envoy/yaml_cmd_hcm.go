@@ -0,0 +1,180 @@
+package envoy
+
+import (
+	"fmt"
+	"strings"
+)
+
+type hcmArgs struct {
+	StatPrefix      string `yaml:"stat_prefix"`
+	RouteConfigName string `yaml:"route_config_name"`
+	CodecType       string `yaml:"codec_type"`
+
+	VirtualHosts []any `yaml:"virtual_hosts"`
+	Filters      []any `yaml:"filters"`
+	AccessLog    []any `yaml:"access_log"`
+
+	RequestTimeout        duration `yaml:"request_timeout"`
+	RequestHeadersTimeout duration `yaml:"request_headers_timeout"`
+	StreamIdleTimeout     duration `yaml:"stream_idle_timeout"`
+	IdleTimeout           duration `yaml:"idle_timeout"`
+
+	UseRemoteAddress  bool `yaml:"use_remote_address"`
+	XffNumTrustedHops int  `yaml:"xff_num_trusted_hops"`
+
+	ServerName                 string `yaml:"server_name"`
+	ServerHeaderTransformation string `yaml:"server_header_transformation"`
+
+	Websocket bool          `yaml:"websocket"`
+	HTTP2     *hcmHTTP2Args `yaml:"http2"`
+	HTTP3     bool          `yaml:"http3"`
+
+	Tracing *bool `yaml:"tracing"`
+}
+
+type hcmHTTP2Args struct {
+	MaxConcurrentStreams        int `yaml:"max_concurrent_streams"`
+	InitialStreamWindowSize     int `yaml:"initial_stream_window_size"`
+	InitialConnectionWindowSize int `yaml:"initial_connection_window_size"`
+}
+
+var hcmCodecTypes = map[string]string{
+	"auto":  "AUTO",
+	"http1": "HTTP1",
+	"http2": "HTTP2",
+}
+
+var hcmServerHeaderTransformations = map[string]string{
+	"overwrite":        "OVERWRITE",
+	"append_if_absent": "APPEND_IF_ABSENT",
+	"pass_through":     "PASS_THROUGH",
+}
+
+// cmdHCM generates an envoy.filters.network.http_connection_manager
+// network filter.
+//
+// "filters" is passed to the "http_filters" command, thus the router
+// filter is added automatically.
+// If route_config_name is not specified, stat_prefix is used.
+// If access_log is not specified, the default access log configured in
+// envoy.yaml is used, an empty list "[]" disables it.
+// If http3 is enabled, a companion QUIC listener is generated for the
+// filter chain, see addHTTP3Listeners.
+// If tracing is configured in envoy.yaml, it is enabled unless tracing
+// is set to false.
+func (p *YAMLParser) cmdHCM(arg any) (any, error) {
+	var args hcmArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.StatPrefix == "" {
+		return nil, fmt.Errorf("hcm: stat_prefix is required")
+	}
+	if len(args.VirtualHosts) == 0 {
+		return nil, fmt.Errorf("hcm %s: virtual_hosts is required", args.StatPrefix)
+	}
+	if args.RouteConfigName == "" {
+		args.RouteConfigName = args.StatPrefix
+	}
+	if args.CodecType == "" {
+		args.CodecType = "auto"
+	}
+	codecType, ok := hcmCodecTypes[strings.ToLower(args.CodecType)]
+	if !ok {
+		return nil, fmt.Errorf("hcm %s: unsupported codec_type %q", args.StatPrefix, args.CodecType)
+	}
+	var serverHeaderTransformation string
+	if args.ServerHeaderTransformation != "" {
+		serverHeaderTransformation, ok = hcmServerHeaderTransformations[strings.ToLower(args.ServerHeaderTransformation)]
+		if !ok {
+			return nil, fmt.Errorf("hcm %s: unsupported server_header_transformation %q", args.StatPrefix, args.ServerHeaderTransformation)
+		}
+	}
+
+	filters := args.Filters
+	if filters == nil {
+		filters = []any{}
+	}
+	config := map[string]any{
+		"@type":       "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
+		"stat_prefix": args.StatPrefix,
+		"codec_type":  codecType,
+		"http_filters": map[string]any{
+			cmdPrefix + "http_filters": filters,
+		},
+		"route_config": map[string]any{
+			"name":          args.RouteConfigName,
+			"virtual_hosts": args.VirtualHosts,
+		},
+	}
+	if args.AccessLog == nil {
+		args.AccessLog = p.defaultAccessLogs(false)
+	}
+	if len(args.AccessLog) > 0 {
+		config["access_log"] = args.AccessLog
+	}
+	if args.RequestTimeout > 0 {
+		config["request_timeout"] = args.RequestTimeout.String()
+	}
+	if args.RequestHeadersTimeout > 0 {
+		config["request_headers_timeout"] = args.RequestHeadersTimeout.String()
+	}
+	if args.StreamIdleTimeout > 0 {
+		config["stream_idle_timeout"] = args.StreamIdleTimeout.String()
+	}
+	if args.IdleTimeout > 0 {
+		config["common_http_protocol_options"] = map[string]any{
+			"idle_timeout": args.IdleTimeout.String(),
+		}
+	}
+	if args.UseRemoteAddress {
+		config["use_remote_address"] = true
+	}
+	if args.XffNumTrustedHops > 0 {
+		config["xff_num_trusted_hops"] = args.XffNumTrustedHops
+	}
+	if args.ServerName != "" {
+		config["server_name"] = args.ServerName
+	}
+	if serverHeaderTransformation != "" {
+		config["server_header_transformation"] = serverHeaderTransformation
+	}
+	if args.Websocket {
+		config["upgrade_configs"] = []any{
+			map[string]any{"upgrade_type": "websocket"},
+		}
+	}
+	if h2 := args.HTTP2; h2 != nil {
+		h2Opts := map[string]any{}
+		if h2.MaxConcurrentStreams > 0 {
+			h2Opts["max_concurrent_streams"] = h2.MaxConcurrentStreams
+		}
+		if h2.InitialStreamWindowSize > 0 {
+			h2Opts["initial_stream_window_size"] = h2.InitialStreamWindowSize
+		}
+		if h2.InitialConnectionWindowSize > 0 {
+			h2Opts["initial_connection_window_size"] = h2.InitialConnectionWindowSize
+		}
+		config["http2_protocol_options"] = h2Opts
+	}
+	if args.Tracing == nil || *args.Tracing {
+		if p.cfg.tracingEnabled() {
+			tracing, err := p.cfg.tracingConfig()
+			if err != nil {
+				return nil, fmt.Errorf("hcm %s: %w", args.StatPrefix, err)
+			}
+			config["tracing"] = tracing
+		} else if args.Tracing != nil {
+			return nil, fmt.Errorf("hcm %s: tracing is not configured in envoy.yaml", args.StatPrefix)
+		}
+	}
+
+	filter := map[string]any{
+		"name":         "envoy.filters.network.http_connection_manager",
+		"typed_config": config,
+	}
+	if args.HTTP3 {
+		filter[http3MarkerKey] = true
+	}
+	return filter, nil
+}
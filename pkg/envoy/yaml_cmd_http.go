@@ -0,0 +1,538 @@
+package envoy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const httpRouterFilterName = "envoy.filters.http.router"
+
+// httpFilterPresets are HTTP filters which can be referenced by name
+// in the "http_filters" command.
+var httpFilterPresets = map[string]func(p *YAMLParser, arg any) (any, error){
+	"router":          (*YAMLParser).cmdHTTPRouter,
+	"cors":            (*YAMLParser).cmdHTTPCors,
+	"compressor":      (*YAMLParser).cmdHTTPCompressor,
+	"local_ratelimit": (*YAMLParser).cmdHTTPLocalRateLimit,
+	"health_check":    (*YAMLParser).cmdHTTPHealthCheck,
+	"buffer":          (*YAMLParser).cmdHTTPBuffer,
+	"lua":             (*YAMLParser).cmdHTTPLua,
+	"basic_auth":      (*YAMLParser).cmdHTTPBasicAuth,
+	"ip_filter":       (*YAMLParser).cmdHTTPIPFilter,
+	"ext_authz":       (*YAMLParser).cmdExtAuthz,
+	"fault":           (*YAMLParser).cmdHTTPFault,
+}
+
+// cmdHTTPFilters expands an ordered list of HTTP filters.
+//
+// Each element is either a preset name, e.g. "cors", a mapping from
+// preset name to its options, e.g. {"compressor": {"algorithm": "brotli"}},
+// or a raw HTTP filter configuration which contains "name".
+// The router filter is always placed last, and is added automatically
+// if it is not specified.
+func (p *YAMLParser) cmdHTTPFilters(arg any) (any, error) {
+	var items []any
+	switch x := arg.(type) {
+	case nil:
+	case []any:
+		items = x
+	default:
+		return nil, fmt.Errorf("http_filters arg must be a list, got %v", arg)
+	}
+
+	var filters []any
+	var router any
+	for i, item := range items {
+		name, opts, isPreset, err := parseHTTPFilterItem(item)
+		if err != nil {
+			return nil, fmt.Errorf("http_filters[%d]: %w", i, err)
+		}
+		if !isPreset {
+			if name == httpRouterFilterName {
+				router = item
+			} else {
+				filters = append(filters, item)
+			}
+			continue
+		}
+		presetFunc := httpFilterPresets[name]
+		filter, err := presetFunc(p, opts)
+		if err != nil {
+			return nil, fmt.Errorf("http_filters[%d]: %s: %w", i, name, err)
+		}
+		if name == "router" {
+			router = filter
+		} else {
+			filters = append(filters, filter)
+		}
+	}
+	if router == nil {
+		var err error
+		router, err = p.cmdHTTPRouter(nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	filters = append(filters, router)
+	return filters, nil
+}
+
+func parseHTTPFilterItem(item any) (name string, opts any, isPreset bool, err error) {
+	switch x := item.(type) {
+	case string:
+		if _, ok := httpFilterPresets[x]; !ok {
+			return "", nil, false, fmt.Errorf("unknown http filter preset %q", x)
+		}
+		return x, nil, true, nil
+	case map[string]any:
+		if rawName, ok := x["name"]; ok {
+			name, _ = rawName.(string)
+			return name, nil, false, nil
+		}
+		if len(x) == 1 {
+			for k, v := range x {
+				if _, ok := httpFilterPresets[k]; !ok {
+					return "", nil, false, fmt.Errorf("unknown http filter preset %q", k)
+				}
+				return k, v, true, nil
+			}
+		}
+	}
+	return "", nil, false, fmt.Errorf("invalid http filter %v", item)
+}
+
+type httpRouterArgs struct {
+	SuppressEnvoyHeaders bool  `yaml:"suppress_envoy_headers"`
+	DynamicStats         *bool `yaml:"dynamic_stats"`
+}
+
+func (p *YAMLParser) cmdHTTPRouter(arg any) (any, error) {
+	var args httpRouterArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+
+	tmpl := `
+name: envoy.filters.http.router
+typed_config:
+  '@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router
+  {{- if .SuppressEnvoyHeaders }}
+  suppress_envoy_headers: true
+  {{- end }}
+  {{- if .DynamicStats }}
+  dynamic_stats: {{ not .DisableDynamicStats }}
+  {{- end }}
+`
+	return p.parseYAML(tmpl, map[string]any{
+		"SuppressEnvoyHeaders": args.SuppressEnvoyHeaders,
+		"DynamicStats":         args.DynamicStats != nil,
+		"DisableDynamicStats":  args.DynamicStats != nil && !*args.DynamicStats,
+	})
+}
+
+// cmdHTTPCors generates the CORS filter, which takes no options.
+// The CORS policy is configured by "cors_policy" on virtual hosts or routes.
+func (p *YAMLParser) cmdHTTPCors(arg any) (any, error) {
+	var args map[string]any
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if len(args) > 0 {
+		return nil, fmt.Errorf("cors filter takes no options, configure the policy with \"!@@ cors_policy\" on virtual hosts or routes")
+	}
+	tmpl := `
+name: envoy.filters.http.cors
+typed_config:
+  '@type': type.googleapis.com/envoy.extensions.filters.http.cors.v3.Cors
+`
+	return p.parseYAML(tmpl)
+}
+
+type corsPolicyArgs struct {
+	AllowOrigins     []string `yaml:"allow_origins"`
+	AllowMethods     []string `yaml:"allow_methods"`
+	AllowHeaders     []string `yaml:"allow_headers"`
+	ExposeHeaders    []string `yaml:"expose_headers"`
+	MaxAge           duration `yaml:"max_age"`
+	AllowCredentials bool     `yaml:"allow_credentials"`
+}
+
+// cmdCorsPolicy generates the per-route CORS policy, which is used on
+// virtual hosts or routes, together with the "http_cors" filter.
+//
+// An origin which starts with "*." matches the domain's subdomains,
+// "*" matches any origin.
+func (p *YAMLParser) cmdCorsPolicy(arg any) (any, error) {
+	var args corsPolicyArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if len(args.AllowOrigins) == 0 {
+		return nil, fmt.Errorf("cors_policy: allow_origins is required")
+	}
+
+	var origins []any
+	for _, origin := range args.AllowOrigins {
+		switch {
+		case origin == "*":
+			origins = append(origins, map[string]any{"safe_regex": map[string]any{"regex": ".*"}})
+		case strings.HasPrefix(origin, "*."):
+			origins = append(origins, map[string]any{"suffix": origin[1:]})
+		default:
+			origins = append(origins, map[string]any{"exact": origin})
+		}
+	}
+	policy := map[string]any{
+		"@type":                     "type.googleapis.com/envoy.extensions.filters.http.cors.v3.CorsPolicy",
+		"allow_origin_string_match": origins,
+	}
+	if len(args.AllowMethods) > 0 {
+		policy["allow_methods"] = strings.Join(args.AllowMethods, ",")
+	}
+	if len(args.AllowHeaders) > 0 {
+		policy["allow_headers"] = strings.Join(args.AllowHeaders, ",")
+	}
+	if len(args.ExposeHeaders) > 0 {
+		policy["expose_headers"] = strings.Join(args.ExposeHeaders, ",")
+	}
+	if args.MaxAge > 0 {
+		policy["max_age"] = fmt.Sprint(int64(time.Duration(args.MaxAge).Seconds()))
+	}
+	if args.AllowCredentials {
+		policy["allow_credentials"] = true
+	}
+	return map[string]any{
+		"typed_per_filter_config": map[string]any{
+			"envoy.filters.http.cors": policy,
+		},
+	}, nil
+}
+
+type httpCompressorArgs struct {
+	Algorithm        string   `yaml:"algorithm"`
+	MinContentLength int      `yaml:"min_content_length"`
+	ContentTypes     []string `yaml:"content_types"`
+}
+
+var compressorLibraries = map[string]string{
+	"gzip":   "type.googleapis.com/envoy.extensions.compression.gzip.compressor.v3.Gzip",
+	"brotli": "type.googleapis.com/envoy.extensions.compression.brotli.compressor.v3.Brotli",
+}
+
+func (p *YAMLParser) cmdHTTPCompressor(arg any) (any, error) {
+	var args httpCompressorArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.Algorithm == "" {
+		args.Algorithm = "gzip"
+	}
+	libType, ok := compressorLibraries[args.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("compressor: unsupported algorithm %q", args.Algorithm)
+	}
+
+	tmpl := `
+name: envoy.filters.http.compressor
+typed_config:
+  '@type': type.googleapis.com/envoy.extensions.filters.http.compressor.v3.Compressor
+  {{- if or .args.MinContentLength .args.ContentTypes }}
+  response_direction_config:
+    common_config:
+      {{- if .args.MinContentLength }}
+      min_content_length: {{ .args.MinContentLength }}
+      {{- end }}
+      {{- if .args.ContentTypes }}
+      content_type:
+        {{- range .args.ContentTypes }}
+        - "{{ . }}"
+        {{- end }}
+      {{- end }}
+  {{- end }}
+  compressor_library:
+    name: "{{ .args.Algorithm }}"
+    typed_config:
+      '@type': {{ .libType }}
+`
+	return p.parseYAML(tmpl, map[string]any{
+		"args":    args,
+		"libType": libType,
+	})
+}
+
+type httpLocalRateLimitArgs struct {
+	StatPrefix    string   `yaml:"stat_prefix"`
+	MaxTokens     int      `yaml:"max_tokens"`
+	TokensPerFill int      `yaml:"tokens_per_fill"`
+	FillInterval  duration `yaml:"fill_interval"`
+}
+
+func (p *YAMLParser) cmdHTTPLocalRateLimit(arg any) (any, error) {
+	var args httpLocalRateLimitArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.MaxTokens <= 0 {
+		return nil, fmt.Errorf("local_ratelimit: max_tokens is required")
+	}
+	if args.StatPrefix == "" {
+		args.StatPrefix = "http_local_rate_limiter"
+	}
+	if args.TokensPerFill == 0 {
+		args.TokensPerFill = args.MaxTokens
+	}
+	if args.FillInterval == 0 {
+		args.FillInterval = duration(time.Second)
+	}
+
+	tmpl := `
+name: envoy.filters.http.local_ratelimit
+typed_config:
+  '@type': type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit
+  stat_prefix: "{{ .StatPrefix }}"
+  token_bucket:
+    max_tokens: {{ .MaxTokens }}
+    tokens_per_fill: {{ .TokensPerFill }}
+    fill_interval: {{ .FillInterval }}
+  filter_enabled:
+    runtime_key: local_rate_limit_enabled
+    default_value:
+      numerator: 100
+      denominator: HUNDRED
+  filter_enforced:
+    runtime_key: local_rate_limit_enforced
+    default_value:
+      numerator: 100
+      denominator: HUNDRED
+`
+	return p.parseYAML(tmpl, args)
+}
+
+type httpHealthCheckArgs struct {
+	Path            string `yaml:"path"`
+	PassThroughMode bool   `yaml:"pass_through_mode"`
+}
+
+func (p *YAMLParser) cmdHTTPHealthCheck(arg any) (any, error) {
+	var args httpHealthCheckArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.Path == "" {
+		args.Path = "/healthz"
+	}
+
+	tmpl := `
+name: envoy.filters.http.health_check
+typed_config:
+  '@type': type.googleapis.com/envoy.extensions.filters.http.health_check.v3.HealthCheck
+  pass_through_mode: {{ .PassThroughMode }}
+  headers:
+    - name: ":path"
+      string_match:
+        exact: "{{ .Path }}"
+`
+	return p.parseYAML(tmpl, args)
+}
+
+type httpBufferArgs struct {
+	MaxRequestBytes int `yaml:"max_request_bytes"`
+}
+
+func (p *YAMLParser) cmdHTTPBuffer(arg any) (any, error) {
+	var args httpBufferArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.MaxRequestBytes <= 0 {
+		args.MaxRequestBytes = 1 << 20
+	}
+
+	tmpl := `
+name: envoy.filters.http.buffer
+typed_config:
+  '@type': type.googleapis.com/envoy.extensions.filters.http.buffer.v3.Buffer
+  max_request_bytes: {{ .MaxRequestBytes }}
+`
+	return p.parseYAML(tmpl, args)
+}
+
+type httpLuaArgs struct {
+	File   string `yaml:"file"`
+	Source string `yaml:"source"`
+}
+
+// cmdHTTPLua generates a Lua filter, the script is either given inline
+// by "source", or loaded from a file in the includes directory.
+func (p *YAMLParser) cmdHTTPLua(arg any) (any, error) {
+	var args httpLuaArgs
+	if s, ok := arg.(string); ok {
+		args.File = s
+	} else if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if (args.File == "") == (args.Source == "") {
+		return nil, fmt.Errorf("lua: exactly one of file and source must be specified")
+	}
+
+	source := args.Source
+	if args.File != "" {
+		data, err := p.readIncludeFile(args.File)
+		if err != nil {
+			return nil, fmt.Errorf("lua: %w", err)
+		}
+		source = string(data)
+	}
+	return map[string]any{
+		"name": "envoy.filters.http.lua",
+		"typed_config": map[string]any{
+			"@type": "type.googleapis.com/envoy.extensions.filters.http.lua.v3.Lua",
+			"default_source_code": map[string]any{
+				"inline_string": source,
+			},
+		},
+	}, nil
+}
+
+type httpFaultArgs struct {
+	Delay           *faultDelayArgs   `yaml:"delay"`
+	Abort           *faultAbortArgs   `yaml:"abort"`
+	Headers         map[string]string `yaml:"headers"`
+	UpstreamCluster string            `yaml:"upstream_cluster"`
+	MaxActiveFaults int               `yaml:"max_active_faults"`
+}
+
+type faultDelayArgs struct {
+	Duration   duration `yaml:"duration"`
+	Percent    *float64 `yaml:"percent"`
+	FromHeader bool     `yaml:"from_header"`
+}
+
+type faultAbortArgs struct {
+	Status     int      `yaml:"status"`
+	GRPCStatus int      `yaml:"grpc_status"`
+	Percent    *float64 `yaml:"percent"`
+	FromHeader bool     `yaml:"from_header"`
+}
+
+// cmdHTTPFault generates a fault injection filter, which delays or
+// aborts a percentage (defaults to 100) of requests.
+//
+// If from_header is true, the delay duration or abort status is taken
+// from the request headers "x-envoy-fault-delay-request" and
+// "x-envoy-fault-abort-request", requests without the headers are not
+// faulted. If headers is specified, only requests which match all the
+// headers are faulted, an empty value matches any value.
+func (p *YAMLParser) cmdHTTPFault(arg any) (any, error) {
+	var args httpFaultArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.Delay == nil && args.Abort == nil {
+		return nil, fmt.Errorf("fault: delay or abort is required")
+	}
+
+	config := map[string]any{
+		"@type": "type.googleapis.com/envoy.extensions.filters.http.fault.v3.HTTPFault",
+	}
+	if d := args.Delay; d != nil {
+		delay := map[string]any{}
+		switch {
+		case d.FromHeader:
+			delay["header_delay"] = map[string]any{}
+		case d.Duration > 0:
+			delay["fixed_delay"] = d.Duration.String()
+		default:
+			return nil, fmt.Errorf("fault: delay requires duration or from_header")
+		}
+		percentage, err := faultPercentage(d.Percent)
+		if err != nil {
+			return nil, err
+		}
+		delay["percentage"] = percentage
+		config["delay"] = delay
+	}
+	if a := args.Abort; a != nil {
+		abort := map[string]any{}
+		switch {
+		case a.FromHeader:
+			abort["header_abort"] = map[string]any{}
+		case a.Status > 0:
+			abort["http_status"] = a.Status
+		case a.GRPCStatus > 0:
+			abort["grpc_status"] = a.GRPCStatus
+		default:
+			return nil, fmt.Errorf("fault: abort requires status, grpc_status or from_header")
+		}
+		percentage, err := faultPercentage(a.Percent)
+		if err != nil {
+			return nil, err
+		}
+		abort["percentage"] = percentage
+		config["abort"] = abort
+	}
+	if len(args.Headers) > 0 {
+		names := make([]string, 0, len(args.Headers))
+		for name := range args.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		headers := make([]any, 0, len(names))
+		for _, name := range names {
+			matcher := map[string]any{"name": name}
+			if value := args.Headers[name]; value == "" {
+				matcher["present_match"] = true
+			} else {
+				matcher["string_match"] = map[string]any{"exact": value}
+			}
+			headers = append(headers, matcher)
+		}
+		config["headers"] = headers
+	}
+	if args.UpstreamCluster != "" {
+		config["upstream_cluster"] = args.UpstreamCluster
+	}
+	if args.MaxActiveFaults > 0 {
+		config["max_active_faults"] = args.MaxActiveFaults
+	}
+	return map[string]any{
+		"name":         "envoy.filters.http.fault",
+		"typed_config": config,
+	}, nil
+}
+
+func faultPercentage(percent *float64) (map[string]any, error) {
+	if percent == nil {
+		return fractionalPercent(100), nil
+	}
+	if *percent < 0 || *percent > 100 {
+		return nil, fmt.Errorf("fault: percent must be in range [0, 100]")
+	}
+	return fractionalPercent(*percent), nil
+}
+
+// readIncludeFile reads a file in the includes directory.
+func (p *YAMLParser) readIncludeFile(name string) ([]byte, error) {
+	return readFileInDir(p.cfg.IncludesPath(), name)
+}
+
+// readConfFile reads a file in the configuration directory.
+func (p *YAMLParser) readConfFile(name string) ([]byte, error) {
+	return readFileInDir(p.cfg.confDir, name)
+}
+
+func readFileInDir(dir, name string) ([]byte, error) {
+	cleanName := filepath.Clean(name)
+	if filepath.IsAbs(cleanName) || strings.HasPrefix(cleanName, "..") {
+		return nil, fmt.Errorf("file %q must be relative to directory %s", name, dir)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, cleanName))
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	return data, nil
+}
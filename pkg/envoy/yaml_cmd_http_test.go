@@ -0,0 +1,42 @@
+package envoy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTTPFiltersCors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "preset name", input: `[cors]`},
+		{name: "empty options", input: `[{cors: {}}]`},
+		{name: "null options", input: `[{cors: null}]`},
+		{
+			name:    "policy options",
+			input:   `[{cors: {allow_origins: ["*.example.com"]}}]`,
+			wantErr: "cors_policy",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &YAMLParser{cfg: &Configuration{}}
+			got, err := p.cmdHTTPFilters(mustParseYAML(t, tc.input))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("cmdHTTPFilters got error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cmdHTTPFilters: %v", err)
+			}
+			filters := got.([]any)
+			if name := filters[0].(map[string]any)["name"]; name != "envoy.filters.http.cors" {
+				t.Errorf("first filter got %v", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package envoy
+
+import (
+	"sort"
+)
+
+const proxyProtocolFilterName = "envoy.filters.listener.proxy_protocol"
+
+type proxyProtocolArgs struct {
+	AllowRequestsWithoutProxyProtocol bool `yaml:"allow_requests_without_proxy_protocol"`
+}
+
+// cmdProxyProtocol generates the envoy.filters.listener.proxy_protocol
+// listener filter, it is moved before other listener filters when
+// generating listeners, see orderListenerFilters.
+func (p *YAMLParser) cmdProxyProtocol(arg any) (any, error) {
+	var args proxyProtocolArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+
+	tmpl := `
+name: ` + proxyProtocolFilterName + `
+typed_config:
+  "@type": type.googleapis.com/envoy.extensions.filters.listener.proxy_protocol.v3.ProxyProtocol
+  {{- if .AllowRequestsWithoutProxyProtocol }}
+  allow_requests_without_proxy_protocol: true
+  {{- end }}
+`
+	return p.parseYAML(tmpl, args)
+}
+
+// orderListenerFilters makes sure the proxy_protocol listener filter is
+// placed before other listener filters, e.g. tls_inspector and
+// http_inspector, which need to see the real connection data.
+func orderListenerFilters(data any) {
+	listeners, ok := data.([]any)
+	if !ok {
+		return
+	}
+	for _, x := range listeners {
+		listener, ok := x.(map[string]any)
+		if !ok {
+			continue
+		}
+		filters, ok := listener["listener_filters"].([]any)
+		if !ok {
+			continue
+		}
+		sort.SliceStable(filters, func(i, j int) bool {
+			return isProxyProtocolFilter(filters[i]) && !isProxyProtocolFilter(filters[j])
+		})
+	}
+}
+
+func isProxyProtocolFilter(x any) bool {
+	filter, ok := x.(map[string]any)
+	return ok && filter["name"] == proxyProtocolFilterName
+}
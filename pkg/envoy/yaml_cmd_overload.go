@@ -0,0 +1,176 @@
+package envoy
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jxskiss/gopkg/v2/zlog"
+)
+
+const (
+	defaultHeapPercent                    = 80
+	defaultShrinkHeapThreshold            = 0.95
+	defaultStopAcceptingRequestsThreshold = 0.98
+
+	// bytesPerDownstreamConnection is the estimated heap usage of a
+	// downstream connection, which is used to derive the connection
+	// limit from the heap size.
+	bytesPerDownstreamConnection = 64 << 10
+)
+
+// cmdOverloadManager generates the bootstrap overload_manager, which is
+// sized from the memory limit of the container, or overload.memoryLimit
+// in envoy.yaml. It generates nothing if overload manager is disabled,
+// or memory is not limited.
+//
+// The max heap size is heapPercent (default 80%) of the memory limit,
+// leaving room for memory which is not allocated from the heap.
+// Envoy shrinks the heap at shrinkHeapThreshold, and stops accepting
+// requests at stopAcceptingRequestsThreshold of the max heap size.
+// Downstream connections are limited to maxDownstreamConnections, which
+// defaults to one per 64KiB of heap, but no more than maxOpenFilesNum,
+// and at least one.
+func (p *YAMLParser) cmdOverloadManager(arg any) (any, error) {
+	ol := &p.cfg.Overload
+	if ol.Disable {
+		return nil, nil
+	}
+
+	var memoryLimit uint64
+	if ol.MemoryLimit != "" {
+		x, err := parseByteSize(ol.MemoryLimit)
+		if err != nil {
+			return nil, fmt.Errorf("overload: invalid memoryLimit: %w", err)
+		}
+		memoryLimit = x
+	} else {
+		x, err := detectMemoryLimit()
+		if err != nil {
+			zlog.Warnf("failed detect cgroup memory limit, overload manager is disabled, err= %v", err)
+			return nil, nil
+		}
+		if x == 0 {
+			zlog.Infof("memory is not limited by cgroup, overload manager is disabled")
+			return nil, nil
+		}
+		zlog.Infof("detected cgroup memory limit: %d bytes", x)
+		memoryLimit = x
+	}
+
+	heapPercent := ol.HeapPercent
+	if heapPercent == 0 {
+		heapPercent = defaultHeapPercent
+	}
+	if heapPercent < 0 || heapPercent > 100 {
+		return nil, fmt.Errorf("overload: heapPercent must be in range (0, 100], got %d", heapPercent)
+	}
+	shrinkHeap := ol.ShrinkHeapThreshold
+	if shrinkHeap == 0 {
+		shrinkHeap = defaultShrinkHeapThreshold
+	}
+	stopAccepting := ol.StopAcceptingRequestsThreshold
+	if stopAccepting == 0 {
+		stopAccepting = defaultStopAcceptingRequestsThreshold
+	}
+	for _, x := range []float64{shrinkHeap, stopAccepting} {
+		if x < 0 || x > 1 {
+			return nil, fmt.Errorf("overload: threshold must be in range (0, 1], got %v", x)
+		}
+	}
+	if shrinkHeap >= stopAccepting {
+		return nil, fmt.Errorf("overload: shrinkHeapThreshold %v must be less than stopAcceptingRequestsThreshold %v", shrinkHeap, stopAccepting)
+	}
+
+	maxHeapSize := memoryLimit / 100 * uint64(heapPercent)
+	if maxHeapSize == 0 {
+		return nil, fmt.Errorf("overload: memory limit %d bytes is too small", memoryLimit)
+	}
+	maxConnections := ol.MaxDownstreamConnections
+	if maxConnections == 0 {
+		maxConnections = maxHeapSize / bytesPerDownstreamConnection
+		if p.cfg.MaxOpenFilesNum > 0 && maxConnections > p.cfg.MaxOpenFilesNum {
+			maxConnections = p.cfg.MaxOpenFilesNum
+		}
+		if maxConnections == 0 {
+			maxConnections = 1
+		}
+	}
+	zlog.Infof("overload manager: max heap size %d bytes, max downstream connections %d", maxHeapSize, maxConnections)
+
+	const heapMonitor = "envoy.resource_monitors.fixed_heap"
+	heapTrigger := func(threshold float64) []any {
+		return []any{
+			map[string]any{
+				"name":      heapMonitor,
+				"threshold": map[string]any{"value": threshold},
+			},
+		}
+	}
+	return map[string]any{
+		"overload_manager": map[string]any{
+			"refresh_interval": "0.25s",
+			"resource_monitors": []any{
+				map[string]any{
+					"name": heapMonitor,
+					"typed_config": map[string]any{
+						"@type":               "type.googleapis.com/envoy.extensions.resource_monitors.fixed_heap.v3.FixedHeapConfig",
+						"max_heap_size_bytes": maxHeapSize,
+					},
+				},
+				map[string]any{
+					"name": "envoy.resource_monitors.global_downstream_max_connections",
+					"typed_config": map[string]any{
+						"@type":                             "type.googleapis.com/envoy.extensions.resource_monitors.downstream_connections.v3.DownstreamConnectionsConfig",
+						"max_active_downstream_connections": maxConnections,
+					},
+				},
+			},
+			"actions": []any{
+				map[string]any{
+					"name":     "envoy.overload_actions.shrink_heap",
+					"triggers": heapTrigger(shrinkHeap),
+				},
+				map[string]any{
+					"name":     "envoy.overload_actions.stop_accepting_requests",
+					"triggers": heapTrigger(stopAccepting),
+				},
+			},
+		},
+	}, nil
+}
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   uint64
+}{
+	{"Ki", 1 << 10},
+	{"Mi", 1 << 20},
+	{"Gi", 1 << 30},
+	{"Ti", 1 << 40},
+	{"K", 1e3},
+	{"M", 1e6},
+	{"G", 1e9},
+	{"T", 1e12},
+}
+
+// parseByteSize parses a size in bytes, which accepts the same suffixes
+// as Kubernetes quantities, e.g. "512Mi", "2Gi", "1G".
+func parseByteSize(s string) (uint64, error) {
+	num, unit := s, uint64(1)
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			num, unit = strings.TrimSuffix(s, u.suffix), u.size
+			break
+		}
+	}
+	x, err := strconv.ParseUint(strings.TrimSpace(num), 10, 64)
+	if err != nil || x == 0 {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	if x > math.MaxUint64/unit {
+		return 0, fmt.Errorf("byte size %q overflows", s)
+	}
+	return x * unit, nil
+}
@@ -0,0 +1,137 @@
+package envoy
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	testCases := []struct {
+		input   string
+		want    uint64
+		wantErr bool
+	}{
+		{input: "100", want: 100},
+		{input: "512Mi", want: 512 << 20},
+		{input: "2Gi", want: 2 << 30},
+		{input: "1G", want: 1e9},
+		{input: "3K", want: 3000},
+		{input: "16777215Ti", want: 16777215 << 40},
+		{input: "16777216Ti", wantErr: true},
+		{input: "20000000000T", wantErr: true},
+		{input: "18446744073709551615", want: 18446744073709551615},
+		{input: "0", wantErr: true},
+		{input: "Gi", wantErr: true},
+		{input: "1.5Gi", wantErr: true},
+		{input: "-1Gi", wantErr: true},
+		{input: "x", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := parseByteSize(tc.input)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseByteSize(%q) got %d, want error", tc.input, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parseByteSize(%q) got %d, %v, want %d", tc.input, got, err, tc.want)
+		}
+	}
+}
+
+func TestOverloadManager(t *testing.T) {
+	testCases := []struct {
+		name            string
+		memoryLimit     string
+		maxOpenFiles    uint64
+		shrinkHeap      float64
+		stopAccepting   float64
+		wantHeap        uint64
+		wantConnections uint64
+		wantErr         bool
+	}{
+		{
+			name:            "derived from memory limit",
+			memoryLimit:     "1Gi",
+			maxOpenFiles:    102400,
+			wantHeap:        858993440,
+			wantConnections: 13107,
+		},
+		{
+			name:            "capped by max open files",
+			memoryLimit:     "64Gi",
+			maxOpenFiles:    10000,
+			wantHeap:        54975581360,
+			wantConnections: 10000,
+		},
+		{
+			name:            "small memory limit has at least one connection",
+			memoryLimit:     "50K",
+			wantHeap:        40000,
+			wantConnections: 1,
+		},
+		{
+			name:        "memory limit too small",
+			memoryLimit: "99",
+			wantErr:     true,
+		},
+		{
+			name:          "shrink heap above stop accepting",
+			memoryLimit:   "1Gi",
+			shrinkHeap:    0.99,
+			stopAccepting: 0.9,
+			wantErr:       true,
+		},
+		{
+			name:          "shrink heap equals stop accepting",
+			memoryLimit:   "1Gi",
+			shrinkHeap:    0.9,
+			stopAccepting: 0.9,
+			wantErr:       true,
+		},
+		{
+			name:          "threshold out of range",
+			memoryLimit:   "1Gi",
+			stopAccepting: 1.5,
+			wantErr:       true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Configuration{MaxOpenFilesNum: tc.maxOpenFiles}
+			cfg.Overload.MemoryLimit = tc.memoryLimit
+			cfg.Overload.ShrinkHeapThreshold = tc.shrinkHeap
+			cfg.Overload.StopAcceptingRequestsThreshold = tc.stopAccepting
+			p := &YAMLParser{cfg: cfg}
+			result, err := p.cmdOverloadManager(nil)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("cmdOverloadManager want error, got %v", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cmdOverloadManager: %v", err)
+			}
+			om := result.(map[string]any)["overload_manager"].(map[string]any)
+			monitors := om["resource_monitors"].([]any)
+			heapConfig := monitors[0].(map[string]any)["typed_config"].(map[string]any)
+			connConfig := monitors[1].(map[string]any)["typed_config"].(map[string]any)
+			if got := heapConfig["max_heap_size_bytes"]; got != tc.wantHeap {
+				t.Errorf("max_heap_size_bytes got %v, want %d", got, tc.wantHeap)
+			}
+			if got := connConfig["max_active_downstream_connections"]; got != tc.wantConnections {
+				t.Errorf("max_active_downstream_connections got %v, want %d", got, tc.wantConnections)
+			}
+		})
+	}
+}
+
+func TestOverloadManagerDisabled(t *testing.T) {
+	cfg := &Configuration{}
+	cfg.Overload.Disable = true
+	cfg.Overload.MemoryLimit = "1Gi"
+	p := &YAMLParser{cfg: cfg}
+	result, err := p.cmdOverloadManager(nil)
+	if err != nil || result != nil {
+		t.Fatalf("cmdOverloadManager got %v, %v, want nil", result, err)
+	}
+}
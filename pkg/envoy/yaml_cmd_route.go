@@ -0,0 +1,351 @@
+package envoy
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+)
+
+type routeArgs struct {
+	Name    string         `yaml:"name"`
+	Match   map[string]any `yaml:"match"`
+	Cluster string         `yaml:"cluster"`
+
+	Timeout     *duration  `yaml:"timeout"`
+	IdleTimeout duration   `yaml:"idle_timeout"`
+	Retry       *retryArgs `yaml:"retry"`
+
+	PrefixRewrite string            `yaml:"prefix_rewrite"`
+	RegexRewrite  *regexRewriteArgs `yaml:"regex_rewrite"`
+	HostRewrite   string            `yaml:"host_rewrite"`
+
+	Websocket bool `yaml:"websocket"`
+	Mirror    any  `yaml:"mirror"`
+}
+
+type retryArgs struct {
+	RetryOn       string   `yaml:"retry_on"`
+	Attempts      *int     `yaml:"attempts"`
+	NumRetries    *int     `yaml:"num_retries"`
+	PerTryTimeout duration `yaml:"per_try_timeout"`
+	StatusCodes   []int    `yaml:"status_codes"`
+	Backoff       *struct {
+		BaseInterval duration `yaml:"base_interval"`
+		MaxInterval  duration `yaml:"max_interval"`
+	} `yaml:"backoff"`
+}
+
+type regexRewriteArgs struct {
+	Pattern      string `yaml:"pattern"`
+	Substitution string `yaml:"substitution"`
+}
+
+// cmdRoute generates a route to a cluster with the commonly used options.
+//
+// If match is not specified, it matches all requests.
+// timeout is the timeout of the whole request, "0s" disables it, Envoy
+// defaults to 15s.
+// If retry is specified, retry_on defaults to "5xx,reset,connect-failure".
+// attempts is the total number of tries including the first one, it is
+// rendered as Envoy's num_retries, which is attempts-1. num_retries is
+// accepted as well, only one of them can be set, Envoy defaults to one
+// retry if neither is specified. status_codes are retried when retry_on
+// contains "retriable-status-codes".
+// host_rewrite is either a literal host, or "auto" to rewrite the host
+// to the upstream host name (only for DNS clusters).
+// mirror accepts the same options as the "mirror" command.
+func (p *YAMLParser) cmdRoute(arg any) (any, error) {
+	var args routeArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.Cluster == "" {
+		return nil, fmt.Errorf("route: cluster is required")
+	}
+	if args.Match == nil {
+		args.Match = map[string]any{"prefix": "/"}
+	}
+	if args.PrefixRewrite != "" && args.RegexRewrite != nil {
+		return nil, fmt.Errorf("route: prefix_rewrite and regex_rewrite are mutually exclusive")
+	}
+
+	action := map[string]any{
+		"cluster": args.Cluster,
+	}
+	if args.Timeout != nil {
+		action["timeout"] = args.Timeout.String()
+	}
+	if args.IdleTimeout > 0 {
+		action["idle_timeout"] = args.IdleTimeout.String()
+	}
+	if r := args.Retry; r != nil {
+		if r.RetryOn == "" {
+			r.RetryOn = "5xx,reset,connect-failure"
+		}
+		policy := map[string]any{
+			"retry_on": r.RetryOn,
+		}
+		if r.Attempts != nil {
+			if r.NumRetries != nil {
+				return nil, fmt.Errorf("route: retry attempts and num_retries are mutually exclusive")
+			}
+			if *r.Attempts < 1 {
+				return nil, fmt.Errorf("route: invalid retry attempts %d", *r.Attempts)
+			}
+			numRetries := *r.Attempts - 1
+			r.NumRetries = &numRetries
+		}
+		if r.NumRetries != nil {
+			if *r.NumRetries < 0 {
+				return nil, fmt.Errorf("route: invalid retry num_retries %d", *r.NumRetries)
+			}
+			policy["num_retries"] = *r.NumRetries
+		}
+		if r.PerTryTimeout > 0 {
+			policy["per_try_timeout"] = r.PerTryTimeout.String()
+		}
+		if len(r.StatusCodes) > 0 {
+			policy["retriable_status_codes"] = r.StatusCodes
+		}
+		if b := r.Backoff; b != nil {
+			if b.BaseInterval <= 0 {
+				return nil, fmt.Errorf("route: retry backoff requires base_interval")
+			}
+			backoff := map[string]any{"base_interval": b.BaseInterval.String()}
+			if b.MaxInterval > 0 {
+				backoff["max_interval"] = b.MaxInterval.String()
+			}
+			policy["retry_back_off"] = backoff
+		}
+		action["retry_policy"] = policy
+	}
+	if args.PrefixRewrite != "" {
+		action["prefix_rewrite"] = args.PrefixRewrite
+	}
+	if rr := args.RegexRewrite; rr != nil {
+		if rr.Pattern == "" {
+			return nil, fmt.Errorf("route: regex_rewrite requires pattern")
+		}
+		action["regex_rewrite"] = map[string]any{
+			"pattern":      map[string]any{"regex": rr.Pattern},
+			"substitution": rr.Substitution,
+		}
+	}
+	switch args.HostRewrite {
+	case "":
+	case "auto":
+		action["auto_host_rewrite"] = true
+	default:
+		action["host_rewrite_literal"] = args.HostRewrite
+	}
+	if args.Websocket {
+		action["upgrade_configs"] = []any{
+			map[string]any{"upgrade_type": "websocket"},
+		}
+	}
+	if args.Mirror != nil {
+		mirror, err := p.cmdMirror(args.Mirror)
+		if err != nil {
+			return nil, fmt.Errorf("route: %w", err)
+		}
+		for k, v := range mirror.(map[string]any) {
+			action[k] = v
+		}
+	}
+
+	route := map[string]any{
+		"match": args.Match,
+		"route": action,
+	}
+	if args.Name != "" {
+		route["name"] = args.Name
+	}
+	return route, nil
+}
+
+type weightedRouteArgs struct {
+	Name     string         `yaml:"name"`
+	Match    map[string]any `yaml:"match"`
+	Clusters map[string]int `yaml:"clusters"`
+	Canary   *canaryArgs    `yaml:"canary"`
+}
+
+type canaryArgs struct {
+	Cluster     string `yaml:"cluster"`
+	Header      string `yaml:"header"`
+	HeaderValue string `yaml:"header_value"`
+	Cookie      string `yaml:"cookie"`
+	CookieValue string `yaml:"cookie_value"`
+}
+
+// cmdWeightedRoute generates a route which splits traffic to clusters by
+// weights, the weights must sum to 100.
+// The route name is used by the "envoy traffic shift" command to find
+// and rewrite the weights.
+//
+// If canary is specified, a route which matches the canary header or
+// cookie is generated before the weighted route, requests which match
+// it are always sent to the canary cluster. If header_value is empty,
+// the header matches when present, if cookie_value is empty, the cookie
+// matches with any value. The result is a list of routes in this case.
+func (p *YAMLParser) cmdWeightedRoute(arg any) (any, error) {
+	var args weightedRouteArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.Name == "" {
+		return nil, fmt.Errorf("weighted_route: name is required")
+	}
+	if err := validateClusterWeights(args.Clusters); err != nil {
+		return nil, fmt.Errorf("weighted_route %s: %w", args.Name, err)
+	}
+	if args.Match == nil {
+		args.Match = map[string]any{"prefix": "/"}
+	}
+
+	clusterNames := make([]string, 0, len(args.Clusters))
+	for name := range args.Clusters {
+		clusterNames = append(clusterNames, name)
+	}
+	sort.Strings(clusterNames)
+	clusters := make([]any, 0, len(clusterNames))
+	for _, name := range clusterNames {
+		clusters = append(clusters, map[string]any{
+			"name":   name,
+			"weight": args.Clusters[name],
+		})
+	}
+	route := map[string]any{
+		"name":  args.Name,
+		"match": args.Match,
+		"route": map[string]any{
+			"weighted_clusters": map[string]any{
+				"clusters": clusters,
+			},
+		},
+	}
+	if args.Canary == nil {
+		return route, nil
+	}
+
+	canary := args.Canary
+	if canary.Cluster == "" {
+		return nil, fmt.Errorf("weighted_route %s: canary cluster is required", args.Name)
+	}
+	if (canary.Header == "") == (canary.Cookie == "") {
+		return nil, fmt.Errorf("weighted_route %s: canary requires either header or cookie", args.Name)
+	}
+	var headerMatcher map[string]any
+	if canary.Header != "" {
+		headerMatcher = map[string]any{"name": canary.Header}
+		if canary.HeaderValue == "" {
+			headerMatcher["present_match"] = true
+		} else {
+			headerMatcher["string_match"] = map[string]any{"exact": canary.HeaderValue}
+		}
+	} else {
+		valueRegex := `[^;]*`
+		if canary.CookieValue != "" {
+			valueRegex = regexp.QuoteMeta(canary.CookieValue)
+		}
+		headerMatcher = map[string]any{
+			"name": "cookie",
+			"string_match": map[string]any{
+				"safe_regex": map[string]any{
+					"regex": `(^|.*;\s*)` + regexp.QuoteMeta(canary.Cookie) + `=` + valueRegex + `(;.*|$)`,
+				},
+			},
+		}
+	}
+	canaryMatch := make(map[string]any, len(args.Match)+1)
+	for k, v := range args.Match {
+		canaryMatch[k] = v
+	}
+	headers, _ := canaryMatch["headers"].([]any)
+	canaryMatch["headers"] = append(append([]any{}, headers...), headerMatcher)
+	canaryRoute := map[string]any{
+		"name":  args.Name + "_canary",
+		"match": canaryMatch,
+		"route": map[string]any{
+			"cluster": canary.Cluster,
+		},
+	}
+	return []any{canaryRoute, route}, nil
+}
+
+func validateClusterWeights(clusters map[string]int) error {
+	if len(clusters) == 0 {
+		return fmt.Errorf("clusters is required")
+	}
+	total := 0
+	for name, weight := range clusters {
+		if weight < 0 {
+			return fmt.Errorf("cluster %s: negative weight %d", name, weight)
+		}
+		total += weight
+	}
+	if total != 100 {
+		return fmt.Errorf("cluster weights sum to %d, want 100", total)
+	}
+	return nil
+}
+
+type mirrorArgs struct {
+	Cluster string   `yaml:"cluster"`
+	Percent *float64 `yaml:"percent"`
+}
+
+// cmdMirror shadows a percentage of requests to other clusters, it is
+// used inside a route action and generates "request_mirror_policies".
+// The arg is either a mapping or a list of mappings with cluster and
+// percent (defaults to 100).
+// Responses from the shadow cluster are discarded.
+func (p *YAMLParser) cmdMirror(arg any) (any, error) {
+	var mirrors []mirrorArgs
+	if _, isList := arg.([]any); isList {
+		if err := decodeArgs(arg, &mirrors); err != nil {
+			return nil, err
+		}
+	} else {
+		var m mirrorArgs
+		if err := decodeArgs(arg, &m); err != nil {
+			return nil, err
+		}
+		mirrors = append(mirrors, m)
+	}
+
+	var policies []any
+	for _, m := range mirrors {
+		if m.Cluster == "" {
+			return nil, fmt.Errorf("mirror: cluster is required")
+		}
+		policy := map[string]any{"cluster": m.Cluster}
+		if m.Percent != nil {
+			if *m.Percent < 0 || *m.Percent > 100 {
+				return nil, fmt.Errorf("mirror %s: percent must be in range [0, 100]", m.Cluster)
+			}
+			policy["runtime_fraction"] = map[string]any{
+				"default_value": fractionalPercent(*m.Percent),
+			}
+		}
+		policies = append(policies, policy)
+	}
+	return map[string]any{
+		"request_mirror_policies": policies,
+	}, nil
+}
+
+// fractionalPercent converts a percentage to Envoy's FractionalPercent.
+func fractionalPercent(percent float64) map[string]any {
+	if percent == math.Trunc(percent) {
+		return map[string]any{
+			"numerator":   int(percent),
+			"denominator": "HUNDRED",
+		}
+	}
+	return map[string]any{
+		"numerator":   int(math.Round(percent * 10000)),
+		"denominator": "MILLION",
+	}
+}
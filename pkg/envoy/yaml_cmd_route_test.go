@@ -0,0 +1,72 @@
+package envoy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRouteRetry(t *testing.T) {
+	testCases := []struct {
+		name    string
+		retry   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			retry: `{}`,
+			want:  `{retry_on: "5xx,reset,connect-failure"}`,
+		},
+		{
+			name:  "attempts",
+			retry: `{attempts: 3, per_try_timeout: 10s}`,
+			want:  `{retry_on: "5xx,reset,connect-failure", num_retries: 2, per_try_timeout: 10s}`,
+		},
+		{
+			name:  "single attempt",
+			retry: `{retry_on: reset, attempts: 1}`,
+			want:  `{retry_on: reset, num_retries: 0}`,
+		},
+		{
+			name:  "num_retries",
+			retry: `{retry_on: reset, num_retries: 2}`,
+			want:  `{retry_on: reset, num_retries: 2}`,
+		},
+		{
+			name:    "zero attempts",
+			retry:   `{attempts: 0}`,
+			wantErr: true,
+		},
+		{
+			name:    "negative num_retries",
+			retry:   `{num_retries: -1}`,
+			wantErr: true,
+		},
+		{
+			name:    "attempts and num_retries",
+			retry:   `{attempts: 3, num_retries: 2}`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &YAMLParser{cfg: &Configuration{}}
+			arg := map[string]any{"cluster": "backend", "retry": mustParseYAML(t, tc.retry)}
+			got, err := p.cmdRoute(arg)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("cmdRoute want error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cmdRoute: %v", err)
+			}
+			policy := got.(map[string]any)["route"].(map[string]any)["retry_policy"]
+			want := mustParseYAML(t, tc.want)
+			if !reflect.DeepEqual(policy, want) {
+				t.Errorf("retry_policy got %v, want %v", policy, want)
+			}
+		})
+	}
+}
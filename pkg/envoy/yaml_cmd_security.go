@@ -0,0 +1,413 @@
+package envoy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultRemovedResponseHeaders are response headers removed by the
+// "security_headers" command, which disclose server implementation details.
+//
+// Note that Envoy adds its own "server" header unless the HCM's
+// server_header_transformation is PASS_THROUGH.
+var defaultRemovedResponseHeaders = []string{
+	"server",
+	"x-powered-by",
+	"x-envoy-upstream-service-time",
+	"x-envoy-upstream-healthchecked-cluster",
+	"x-envoy-decorator-operation",
+}
+
+type securityHeadersArgs struct {
+	HSTS               *hstsArgs     `yaml:"hsts"`
+	FrameOptions       *headerOption `yaml:"frame_options"`
+	ContentTypeOptions *bool         `yaml:"content_type_options"`
+	ReferrerPolicy     *headerOption `yaml:"referrer_policy"`
+	CSP                string        `yaml:"csp"`
+	RemoveHeaders      []string      `yaml:"remove_headers"`
+}
+
+// headerOption is the value of an optional header, it can be written as
+// false or empty string to disable the header, or true to use the
+// default value.
+type headerOption struct {
+	Disabled bool
+	Value    string
+}
+
+func (o *headerOption) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("header option must be a bool or a string")
+	}
+	if value.Tag == "!!bool" {
+		var enable bool
+		if err := value.Decode(&enable); err != nil {
+			return err
+		}
+		o.Disabled = !enable
+		return nil
+	}
+	o.Value = value.Value
+	o.Disabled = value.Value == ""
+	return nil
+}
+
+// get returns the header value, or an empty string if the header is disabled.
+func (o *headerOption) get(defaultValue string) string {
+	switch {
+	case o == nil:
+		return defaultValue
+	case o.Disabled:
+		return ""
+	case o.Value == "":
+		return defaultValue
+	}
+	return o.Value
+}
+
+// hstsArgs configures the Strict-Transport-Security header,
+// it can be written as "hsts: false" to disable the header.
+type hstsArgs struct {
+	Disabled          bool `yaml:"-"`
+	MaxAge            int  `yaml:"max_age"`
+	IncludeSubdomains bool `yaml:"include_subdomains"`
+	Preload           bool `yaml:"preload"`
+}
+
+func (a *hstsArgs) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		var enable bool
+		if err := value.Decode(&enable); err != nil {
+			return fmt.Errorf("hsts must be a bool or a mapping, got %q", value.Value)
+		}
+		a.Disabled = !enable
+		return nil
+	}
+	type plain hstsArgs
+	return value.Decode((*plain)(a))
+}
+
+// cmdSecurityHeaders adds security related response headers, and removes
+// headers which disclose server details, it is used on virtual hosts or
+// routes of HTTPS listeners.
+//
+// By default, it adds HSTS with max-age of one year,
+// "X-Content-Type-Options: nosniff", "X-Frame-Options: DENY" and
+// "Referrer-Policy: strict-origin-when-cross-origin".
+// Content-Security-Policy is added only when csp is specified.
+// Set an option to false or empty string to disable the header.
+func (p *YAMLParser) cmdSecurityHeaders(arg any) (any, error) {
+	var args securityHeadersArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+
+	var headers []any
+	addHeader := func(key, value string) {
+		headers = append(headers, map[string]any{
+			"header": map[string]any{
+				"key":   key,
+				"value": value,
+			},
+			"append_action": "OVERWRITE_IF_EXISTS_OR_ADD",
+		})
+	}
+
+	hsts := args.HSTS
+	if hsts == nil {
+		hsts = &hstsArgs{}
+	}
+	if !hsts.Disabled {
+		if hsts.MaxAge < 0 {
+			return nil, fmt.Errorf("security_headers: invalid hsts max_age %d", hsts.MaxAge)
+		}
+		if hsts.MaxAge == 0 {
+			hsts.MaxAge = 31536000
+		}
+		if hsts.Preload && (!hsts.IncludeSubdomains || hsts.MaxAge < 31536000) {
+			return nil, fmt.Errorf("security_headers: hsts preload requires include_subdomains and max_age of at least one year")
+		}
+		value := fmt.Sprintf("max-age=%d", hsts.MaxAge)
+		if hsts.IncludeSubdomains {
+			value += "; includeSubDomains"
+		}
+		if hsts.Preload {
+			value += "; preload"
+		}
+		addHeader("Strict-Transport-Security", value)
+	}
+	if args.ContentTypeOptions == nil || *args.ContentTypeOptions {
+		addHeader("X-Content-Type-Options", "nosniff")
+	}
+	frameOptions := strings.ToUpper(args.FrameOptions.get("DENY"))
+	switch frameOptions {
+	case "":
+	case "DENY", "SAMEORIGIN":
+		addHeader("X-Frame-Options", frameOptions)
+	default:
+		return nil, fmt.Errorf("security_headers: unsupported frame_options %q", frameOptions)
+	}
+	referrerPolicy := args.ReferrerPolicy.get("strict-origin-when-cross-origin")
+	if referrerPolicy != "" {
+		addHeader("Referrer-Policy", referrerPolicy)
+	}
+	if args.CSP != "" {
+		addHeader("Content-Security-Policy", args.CSP)
+	}
+
+	var removeHeaders []any
+	for _, h := range defaultRemovedResponseHeaders {
+		removeHeaders = append(removeHeaders, h)
+	}
+	for _, h := range args.RemoveHeaders {
+		removeHeaders = append(removeHeaders, strings.ToLower(h))
+	}
+
+	result := map[string]any{
+		"response_headers_to_remove": removeHeaders,
+	}
+	if len(headers) > 0 {
+		result["response_headers_to_add"] = headers
+	}
+	return result, nil
+}
+
+const basicAuthFilterName = "envoy.filters.http.basic_auth"
+
+type basicAuthArgs struct {
+	File string `yaml:"file"`
+}
+
+// cmdHTTPBasicAuth generates the basic auth HTTP filter, which is disabled
+// by default, and enabled on virtual hosts or routes by the "basic_auth"
+// command. If file is specified, the users are used when a virtual host
+// or route enables basic auth without specifying users.
+func (p *YAMLParser) cmdHTTPBasicAuth(arg any) (any, error) {
+	var args basicAuthArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	config := map[string]any{
+		"@type": "type.googleapis.com/envoy.extensions.filters.http.basic_auth.v3.BasicAuth",
+	}
+	if args.File != "" {
+		users, err := p.loadHtpasswd(args.File)
+		if err != nil {
+			return nil, fmt.Errorf("basic_auth: %w", err)
+		}
+		config["users"] = map[string]any{"inline_string": users}
+	}
+	return map[string]any{
+		"name":         basicAuthFilterName,
+		"disabled":     true,
+		"typed_config": config,
+	}, nil
+}
+
+// cmdBasicAuth enables basic auth on a virtual host or route, users are
+// loaded from an htpasswd file in the configuration directory.
+// The HCM must have the basic auth HTTP filter, see cmdHTTPBasicAuth.
+func (p *YAMLParser) cmdBasicAuth(arg any) (any, error) {
+	var args basicAuthArgs
+	if s, ok := arg.(string); ok {
+		args.File = s
+	} else if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.File == "" {
+		return nil, fmt.Errorf("basic_auth: file is required")
+	}
+	users, err := p.loadHtpasswd(args.File)
+	if err != nil {
+		return nil, fmt.Errorf("basic_auth: %w", err)
+	}
+	return map[string]any{
+		"typed_per_filter_config": map[string]any{
+			basicAuthFilterName: map[string]any{
+				"@type": "type.googleapis.com/envoy.extensions.filters.http.basic_auth.v3.BasicAuthPerRoute",
+				"users": map[string]any{
+					"inline_string": users,
+				},
+			},
+		},
+	}, nil
+}
+
+// loadHtpasswd loads and validates an htpasswd file.
+// Envoy supports only SHA1 hashed passwords, which can be generated by
+// "htpasswd -s".
+func (p *YAMLParser) loadHtpasswd(file string) (string, error) {
+	data, err := p.readConfFile(file)
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return "", fmt.Errorf("%s:%d: invalid htpasswd line", file, i+1)
+		}
+		if !strings.HasPrefix(hash, "{SHA}") {
+			return "", fmt.Errorf("%s:%d: user %q: only SHA1 password hash is supported, use 'htpasswd -s'", file, i+1, user)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("%s: no users", file)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+type ipFilterArgs struct {
+	Type       string   `yaml:"type"`
+	StatPrefix string   `yaml:"stat_prefix"`
+	Allow      []string `yaml:"allow"`
+	Deny       []string `yaml:"deny"`
+	UseXFF     bool     `yaml:"use_xff"`
+}
+
+// cmdHTTPIPFilter is the "ip_filter" preset of the "http_filters" command.
+func (p *YAMLParser) cmdHTTPIPFilter(arg any) (any, error) {
+	var args ipFilterArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.Type != "" && args.Type != "http" {
+		return nil, fmt.Errorf("ip_filter: type must be http in http_filters")
+	}
+	args.Type = "http"
+	return p.ipFilter(&args)
+}
+
+// cmdIPFilter generates an RBAC filter which allows or denies clients
+// by CIDR lists. A client is allowed if it matches the allow list (or
+// the allow list is empty), and doesn't match the deny list.
+//
+// type is either "http" (default) or "network". HTTP filters check the
+// client address derived from X-Forwarded-For if use_xff is true, which
+// requires use_remote_address or xff_num_trusted_hops configured on the
+// HCM, else the address of the direct peer is checked.
+func (p *YAMLParser) cmdIPFilter(arg any) (any, error) {
+	var args ipFilterArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	return p.ipFilter(&args)
+}
+
+func (p *YAMLParser) ipFilter(args *ipFilterArgs) (any, error) {
+	if args.Type == "" {
+		args.Type = "http"
+	}
+	if args.Type != "http" && args.Type != "network" {
+		return nil, fmt.Errorf("ip_filter: unsupported type %q", args.Type)
+	}
+	if args.UseXFF && args.Type == "network" {
+		return nil, fmt.Errorf("ip_filter: use_xff is not supported by network filter")
+	}
+	if len(args.Allow) == 0 && len(args.Deny) == 0 {
+		return nil, fmt.Errorf("ip_filter: allow or deny is required")
+	}
+	if args.StatPrefix == "" {
+		args.StatPrefix = "ip_filter."
+	}
+
+	principalKey := "direct_remote_ip"
+	if args.UseXFF {
+		principalKey = "remote_ip"
+	}
+	allowIDs, err := cidrPrincipals(principalKey, args.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("ip_filter: %w", err)
+	}
+	denyIDs, err := cidrPrincipals(principalKey, args.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("ip_filter: %w", err)
+	}
+
+	action := "ALLOW"
+	var principal map[string]any
+	switch {
+	case len(allowIDs) > 0 && len(denyIDs) > 0:
+		principal = map[string]any{
+			"and_ids": map[string]any{
+				"ids": []any{
+					map[string]any{"or_ids": map[string]any{"ids": allowIDs}},
+					map[string]any{"not_id": map[string]any{"or_ids": map[string]any{"ids": denyIDs}}},
+				},
+			},
+		}
+	case len(allowIDs) > 0:
+		principal = map[string]any{"or_ids": map[string]any{"ids": allowIDs}}
+	default:
+		action = "DENY"
+		principal = map[string]any{"or_ids": map[string]any{"ids": denyIDs}}
+	}
+
+	rules := map[string]any{
+		"action": action,
+		"policies": map[string]any{
+			"ip_filter": map[string]any{
+				"permissions": []any{map[string]any{"any": true}},
+				"principals":  []any{principal},
+			},
+		},
+	}
+	if args.Type == "network" {
+		return map[string]any{
+			"name": "envoy.filters.network.rbac",
+			"typed_config": map[string]any{
+				"@type":       "type.googleapis.com/envoy.extensions.filters.network.rbac.v3.RBAC",
+				"stat_prefix": args.StatPrefix,
+				"rules":       rules,
+			},
+		}, nil
+	}
+	return map[string]any{
+		"name": "envoy.filters.http.rbac",
+		"typed_config": map[string]any{
+			"@type":             "type.googleapis.com/envoy.extensions.filters.http.rbac.v3.RBAC",
+			"rules_stat_prefix": args.StatPrefix,
+			"rules":             rules,
+		},
+	}, nil
+}
+
+func cidrPrincipals(key string, cidrs []string) ([]any, error) {
+	var ids []any
+	for _, s := range cidrs {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP or CIDR %q", s)
+			}
+			if ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		ip, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", s)
+		}
+		if !ip.Equal(ipNet.IP) {
+			return nil, fmt.Errorf("CIDR %q has host bits set, use %s", s, ipNet.String())
+		}
+		prefixLen, _ := ipNet.Mask.Size()
+		ids = append(ids, map[string]any{
+			key: map[string]any{
+				"address_prefix": ipNet.IP.String(),
+				"prefix_len":     prefixLen,
+			},
+		})
+	}
+	return ids, nil
+}
@@ -0,0 +1,236 @@
+package envoy
+
+import (
+	"fmt"
+	"strings"
+)
+
+const adminClusterName = "envoy_admin"
+
+var adminClusterTpl = []byte(`
+# admin interface, used by "prometheus_listener"
+- "!@@ simple_cluster":
+    name: ` + adminClusterName + `
+    endpoints:
+      - "127.0.0.1:{{ .AdminPort }}"
+`)
+
+var statsSinkTypes = map[string]struct {
+	name    string
+	typeURL string
+}{
+	"statsd": {
+		name:    "envoy.stat_sinks.statsd",
+		typeURL: "type.googleapis.com/envoy.config.metrics.v3.StatsdSink",
+	},
+	"dogstatsd": {
+		name:    "envoy.stat_sinks.dog_statsd",
+		typeURL: "type.googleapis.com/envoy.config.metrics.v3.DogStatsdSink",
+	},
+}
+
+// StatsSink configures a stats sink which flushes stats to a UDP
+// address, Type is either "statsd" or "dogstatsd".
+type StatsSink struct {
+	Type    string `yaml:"type"`
+	Address string `yaml:"address"`
+	Prefix  string `yaml:"prefix"`
+}
+
+// StatsTag configures a tag extracted from stat names by Regex, or a
+// tag with FixedValue added to all stats.
+type StatsTag struct {
+	Name       string `yaml:"name"`
+	Regex      string `yaml:"regex"`
+	FixedValue string `yaml:"fixedValue"`
+}
+
+// cmdEnvoyStats generates the bootstrap stats_sinks and stats_config
+// from the "stats" section of envoy.yaml, it generates nothing if
+// stats are not configured.
+func (p *YAMLParser) cmdEnvoyStats(arg any) (any, error) {
+	stats := &p.cfg.Stats
+	result := map[string]any{}
+
+	var sinks []any
+	for i, sink := range stats.Sinks {
+		sinkType, ok := statsSinkTypes[sink.Type]
+		if !ok {
+			return nil, fmt.Errorf("stats sinks[%d]: unsupported type %q", i, sink.Type)
+		}
+		if sink.Address == "" {
+			return nil, fmt.Errorf("stats sinks[%d]: address is required", i)
+		}
+		addr, err := p.cmdAddress(sink.Address)
+		if err != nil {
+			return nil, fmt.Errorf("stats sinks[%d]: %w", i, err)
+		}
+		config := map[string]any{
+			"@type":   sinkType.typeURL,
+			"address": addr.(map[string]any)["address"],
+		}
+		if sink.Prefix != "" {
+			config["prefix"] = sink.Prefix
+		}
+		sinks = append(sinks, map[string]any{
+			"name":         sinkType.name,
+			"typed_config": config,
+		})
+	}
+	if len(sinks) > 0 {
+		result["stats_sinks"] = sinks
+	}
+
+	statsConfig := map[string]any{}
+	var tags []any
+	for i, tag := range stats.Tags {
+		if tag.Name == "" {
+			return nil, fmt.Errorf("stats tags[%d]: name is required", i)
+		}
+		if (tag.Regex == "") == (tag.FixedValue == "") {
+			return nil, fmt.Errorf("stats tag %s: exactly one of regex and fixedValue is required", tag.Name)
+		}
+		if tag.Regex != "" {
+			tags = append(tags, map[string]any{"tag_name": tag.Name, "regex": tag.Regex})
+		} else {
+			tags = append(tags, map[string]any{"tag_name": tag.Name, "fixed_value": tag.FixedValue})
+		}
+	}
+	if len(tags) > 0 {
+		statsConfig["stats_tags"] = tags
+	}
+	if stats.UseAllDefaultTags != nil {
+		statsConfig["use_all_default_tags"] = *stats.UseAllDefaultTags
+	}
+	if len(stats.Inclusions) > 0 && len(stats.Exclusions) > 0 {
+		return nil, fmt.Errorf("stats: inclusions and exclusions cannot be used together")
+	}
+	if len(stats.Inclusions) > 0 {
+		patterns, err := statsMatcherPatterns(stats.Inclusions)
+		if err != nil {
+			return nil, err
+		}
+		statsConfig["stats_matcher"] = map[string]any{
+			"inclusion_list": map[string]any{"patterns": patterns},
+		}
+	}
+	if len(stats.Exclusions) > 0 {
+		patterns, err := statsMatcherPatterns(stats.Exclusions)
+		if err != nil {
+			return nil, err
+		}
+		statsConfig["stats_matcher"] = map[string]any{
+			"exclusion_list": map[string]any{"patterns": patterns},
+		}
+	}
+	if len(statsConfig) > 0 {
+		result["stats_config"] = statsConfig
+	}
+
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+var statsMatcherTypes = []string{"exact", "prefix", "suffix", "contains", "regex"}
+
+// statsMatcherPatterns converts patterns in the form "<type>:<value>" to
+// string matchers, type is one of statsMatcherTypes, a pattern without
+// type matches stat names by prefix, e.g. "cluster.api.".
+func statsMatcherPatterns(patterns []string) ([]any, error) {
+	result := make([]any, 0, len(patterns))
+	for _, pattern := range patterns {
+		matchType, value := "prefix", pattern
+		if i := strings.IndexByte(pattern, ':'); i > 0 {
+			for _, t := range statsMatcherTypes {
+				if pattern[:i] == t {
+					matchType, value = t, pattern[i+1:]
+					break
+				}
+			}
+		}
+		if value == "" {
+			return nil, fmt.Errorf("stats: empty matcher pattern %q", pattern)
+		}
+		if matchType == "regex" {
+			result = append(result, map[string]any{
+				"safe_regex": map[string]any{"regex": value},
+			})
+			continue
+		}
+		result = append(result, map[string]any{matchType: value})
+	}
+	return result, nil
+}
+
+type prometheusListenerArgs struct {
+	Name    string   `yaml:"name"`
+	Address string   `yaml:"address"`
+	Allow   []string `yaml:"allow"`
+}
+
+// cmdPrometheusListener generates a listener which exposes only the
+// "/stats/prometheus" endpoint of the admin interface to clients in the
+// allow list, the admin interface itself stays bound to 127.0.0.1.
+// The cluster "envoy_admin" is added to clusters.yaml automatically.
+func (p *YAMLParser) cmdPrometheusListener(arg any) (any, error) {
+	var args prometheusListenerArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.Name == "" {
+		args.Name = "prometheus"
+	}
+	if args.Address == "" {
+		return nil, fmt.Errorf("prometheus_listener %s: address is required", args.Name)
+	}
+	if len(args.Allow) == 0 {
+		return nil, fmt.Errorf("prometheus_listener %s: allow is required", args.Name)
+	}
+	ipFilter, err := p.ipFilter(&ipFilterArgs{
+		Type:       "network",
+		StatPrefix: args.Name + ".ip_filter.",
+		Allow:      args.Allow,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("prometheus_listener %s: %w", args.Name, err)
+	}
+	p.useAdminCluster = true
+
+	return map[string]any{
+		"name":                args.Name,
+		"@type":               "type.googleapis.com/envoy.config.listener.v3.Listener",
+		cmdPrefix + "address": args.Address,
+		"filter_chains": []any{
+			map[string]any{
+				"filters": []any{
+					ipFilter,
+					map[string]any{
+						cmdPrefix + "hcm": map[string]any{
+							"stat_prefix": args.Name,
+							"access_log":  []any{},
+							"tracing":     false,
+							"virtual_hosts": []any{
+								map[string]any{
+									"name":    args.Name,
+									"domains": []any{"*"},
+									"routes": []any{
+										map[string]any{
+											"match": map[string]any{
+												"path": "/stats/prometheus",
+											},
+											"route": map[string]any{
+												"cluster": adminClusterName,
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,280 @@
+package envoy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStatsMatcherPatterns(t *testing.T) {
+	testCases := []struct {
+		input   []string
+		want    string
+		wantErr bool
+	}{
+		{input: []string{"cluster."}, want: `[{prefix: cluster.}]`},
+		{input: []string{"exact:server.live"}, want: `[{exact: server.live}]`},
+		{input: []string{"prefix:http."}, want: `[{prefix: http.}]`},
+		{input: []string{"suffix:.rq_5xx"}, want: `[{suffix: .rq_5xx}]`},
+		{input: []string{"contains:upstream_rq"}, want: `[{contains: upstream_rq}]`},
+		{input: []string{`regex:^http\..*rq_5xx$`}, want: `[{safe_regex: {regex: '^http\..*rq_5xx$'}}]`},
+		{input: []string{"regex:a:b"}, want: `[{safe_regex: {regex: "a:b"}}]`},
+		{input: []string{"cluster.a:b"}, want: `[{prefix: "cluster.a:b"}]`},
+		{input: []string{"unknown:x"}, want: `[{prefix: "unknown:x"}]`},
+		{input: []string{":x"}, want: `[{prefix: ":x"}]`},
+		{input: []string{"cluster.", "exact:server.live"}, want: `[{prefix: cluster.}, {exact: server.live}]`},
+		{input: []string{""}, wantErr: true},
+		{input: []string{"exact:"}, wantErr: true},
+		{input: []string{"regex:"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := statsMatcherPatterns(tc.input)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("statsMatcherPatterns(%q) got %v, want error", tc.input, got)
+			}
+			continue
+		}
+		want := mustParseYAML(t, tc.want)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("statsMatcherPatterns(%q) got %v, %v, want %v", tc.input, got, err, want)
+		}
+	}
+}
+
+func TestEnvoyStats(t *testing.T) {
+	testCases := []struct {
+		name    string
+		setup   func(cfg *Configuration)
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "not configured",
+			setup: func(cfg *Configuration) {},
+			want:  `null`,
+		},
+		{
+			name: "sinks",
+			setup: func(cfg *Configuration) {
+				cfg.Stats.Sinks = []*StatsSink{
+					{Type: "dogstatsd", Address: "127.0.0.1:8125", Prefix: "envoy"},
+				}
+			},
+			want: `
+stats_sinks:
+  - name: envoy.stat_sinks.dog_statsd
+    typed_config:
+      "@type": type.googleapis.com/envoy.config.metrics.v3.DogStatsdSink
+      address: { socket_address: { address: 127.0.0.1, port_value: 8125 } }
+      prefix: envoy
+`,
+		},
+		{
+			name: "tags and inclusions",
+			setup: func(cfg *Configuration) {
+				useAll := false
+				cfg.Stats.UseAllDefaultTags = &useAll
+				cfg.Stats.Tags = []*StatsTag{
+					{Name: "env", FixedValue: "production"},
+					{Name: "route", Regex: `^vhost\.\w+\.route\.((\w+)\.)`},
+				}
+				cfg.Stats.Inclusions = []string{"cluster.", "exact:server.live"}
+			},
+			want: `
+stats_config:
+  use_all_default_tags: false
+  stats_tags:
+    - { tag_name: env, fixed_value: production }
+    - { tag_name: route, regex: '^vhost\.\w+\.route\.((\w+)\.)' }
+  stats_matcher:
+    inclusion_list:
+      patterns: [{ prefix: cluster. }, { exact: server.live }]
+`,
+		},
+		{
+			name: "exclusions",
+			setup: func(cfg *Configuration) {
+				cfg.Stats.Exclusions = []string{"regex:^sds_"}
+			},
+			want: `
+stats_config:
+  stats_matcher:
+    exclusion_list:
+      patterns: [{ safe_regex: { regex: "^sds_" } }]
+`,
+		},
+		{
+			name: "inclusions with exclusions",
+			setup: func(cfg *Configuration) {
+				cfg.Stats.Inclusions = []string{"cluster."}
+				cfg.Stats.Exclusions = []string{"cluster.sds_"}
+			},
+			wantErr: "cannot be used together",
+		},
+		{
+			name: "empty pattern",
+			setup: func(cfg *Configuration) {
+				cfg.Stats.Exclusions = []string{"exact:"}
+			},
+			wantErr: "empty matcher pattern",
+		},
+		{
+			name: "tag with regex and fixedValue",
+			setup: func(cfg *Configuration) {
+				cfg.Stats.Tags = []*StatsTag{{Name: "env", Regex: "x", FixedValue: "y"}}
+			},
+			wantErr: "exactly one of regex and fixedValue",
+		},
+		{
+			name: "tag without regex and fixedValue",
+			setup: func(cfg *Configuration) {
+				cfg.Stats.Tags = []*StatsTag{{Name: "env"}}
+			},
+			wantErr: "exactly one of regex and fixedValue",
+		},
+		{
+			name: "tag without name",
+			setup: func(cfg *Configuration) {
+				cfg.Stats.Tags = []*StatsTag{{FixedValue: "y"}}
+			},
+			wantErr: "name is required",
+		},
+		{
+			name: "unsupported sink type",
+			setup: func(cfg *Configuration) {
+				cfg.Stats.Sinks = []*StatsSink{{Type: "graphite", Address: "127.0.0.1:2003"}}
+			},
+			wantErr: "unsupported type",
+		},
+		{
+			name: "sink without address",
+			setup: func(cfg *Configuration) {
+				cfg.Stats.Sinks = []*StatsSink{{Type: "statsd"}}
+			},
+			wantErr: "address is required",
+		},
+		{
+			name: "sink with hostname",
+			setup: func(cfg *Configuration) {
+				cfg.Stats.Sinks = []*StatsSink{{Type: "statsd", Address: "statsd.example.com:8125"}}
+			},
+			wantErr: "is not an IP",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Configuration{}
+			tc.setup(cfg)
+			p := &YAMLParser{cfg: cfg}
+			got, err := p.cmdEnvoyStats(nil)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("cmdEnvoyStats got error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cmdEnvoyStats: %v", err)
+			}
+			// Compare the printed values, as the result mixes typed
+			// slices and maps.
+			want := mustParseYAML(t, tc.want)
+			if want == nil {
+				if got != nil {
+					t.Errorf("cmdEnvoyStats got %v, want nil", got)
+				}
+				return
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("cmdEnvoyStats got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPrometheusListener(t *testing.T) {
+	testCases := []struct {
+		name    string
+		arg     string
+		wantErr string
+	}{
+		{name: "default name", arg: `{address: "0.0.0.0:9090", allow: ["10.0.0.0/8"]}`},
+		{name: "missing address", arg: `{allow: ["10.0.0.0/8"]}`, wantErr: "address is required"},
+		{name: "missing allow", arg: `{address: "0.0.0.0:9090"}`, wantErr: "allow is required"},
+		{name: "invalid allow", arg: `{address: "0.0.0.0:9090", allow: ["10.0.0.0/33"]}`, wantErr: "prometheus_listener prometheus"},
+		{name: "unknown option", arg: `{address: "0.0.0.0:9090", allow: ["10.0.0.0/8"], port: 9090}`, wantErr: "invalid args"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &YAMLParser{cfg: &Configuration{}}
+			got, err := p.solveCommands("listeners", mustParseYAML(t, `["!@@ prometheus_listener": `+tc.arg+`]`))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("prometheus_listener got error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("prometheus_listener: %v", err)
+			}
+			out := fmt.Sprint(got)
+			for _, s := range []string{"name:prometheus", "port_value:9090", "/stats/prometheus", "cluster:" + adminClusterName} {
+				if !strings.Contains(out, s) {
+					t.Errorf("listener does not contain %q: %s", s, out)
+				}
+			}
+			if !p.useAdminCluster {
+				t.Errorf("useAdminCluster is not set")
+			}
+		})
+	}
+}
+
+func TestGenerateAdminCluster(t *testing.T) {
+	const httpListener = `
+- name: listener_http
+  "!@@ address": "127.0.0.1:10080"
+  filter_chains:
+    - filters:
+        - "!@@ hcm":
+            stat_prefix: ingress_http
+            virtual_hosts:
+              - { name: default, domains: ["*"], routes: [] }
+`
+	const prometheusListener = `
+- "!@@ prometheus_listener":
+    address: "0.0.0.0:9090"
+    allow: [ "10.0.0.0/8" ]
+`
+	testCases := []struct {
+		name      string
+		listeners string
+		want      bool
+	}{
+		{name: "without prometheus_listener", listeners: httpListener, want: false},
+		{name: "with prometheus_listener", listeners: httpListener + prometheusListener, want: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := setupConfDir(t, map[string]string{
+				"listeners.yaml": tc.listeners,
+				"clusters.yaml":  "- { name: backend, type: STATIC }\n",
+			})
+			if err := NewConfigGenerator(cfg).Generate(); err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(cfg.OutputPath(), "clusters.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := strings.Contains(string(data), "name: "+adminClusterName)
+			if got != tc.want {
+				t.Errorf("envoy_admin cluster got %v, want %v:\n%s", got, tc.want, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package envoy
+
+import (
+	"fmt"
+)
+
+type tcpProxyArgs struct {
+	StatPrefix  string   `yaml:"stat_prefix"`
+	Cluster     string   `yaml:"cluster"`
+	IdleTimeout duration `yaml:"idle_timeout"`
+	AccessLog   []any    `yaml:"access_log"`
+}
+
+// cmdTCPProxy generates an envoy.filters.network.tcp_proxy network filter.
+//
+// If stat_prefix is not specified, the cluster name is used.
+// If access_log is not specified, the default access log configured in
+// envoy.yaml is used with the "tcp_access_log" defaults, an empty list
+// "[]" disables it.
+func (p *YAMLParser) cmdTCPProxy(arg any) (any, error) {
+	var args tcpProxyArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	return p.tcpProxyFilter(&args)
+}
+
+func (p *YAMLParser) tcpProxyFilter(args *tcpProxyArgs) (any, error) {
+	if args.Cluster == "" {
+		return nil, fmt.Errorf("tcp_proxy: cluster is required")
+	}
+	if args.StatPrefix == "" {
+		args.StatPrefix = args.Cluster
+	}
+
+	config := map[string]any{
+		"@type":       "type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy",
+		"stat_prefix": args.StatPrefix,
+		"cluster":     args.Cluster,
+	}
+	if args.IdleTimeout > 0 {
+		config["idle_timeout"] = args.IdleTimeout.String()
+	}
+	if args.AccessLog == nil {
+		args.AccessLog = p.defaultAccessLogs(true)
+	}
+	if len(args.AccessLog) > 0 {
+		config["access_log"] = args.AccessLog
+	}
+	return map[string]any{
+		"name":         "envoy.filters.network.tcp_proxy",
+		"typed_config": config,
+	}, nil
+}
+
+type sniPassthroughRoute struct {
+	ServerNames  []string `yaml:"server_names"`
+	tcpProxyArgs `yaml:",inline"`
+}
+
+// cmdSNIPassthrough generates filter chains which route raw TLS
+// connections by SNI to clusters, without terminating TLS.
+// The listener must have the tls_inspector listener filter.
+//
+// The arg is a list of routes, each route has "server_names" and
+// the options of the "tcp_proxy" command.
+func (p *YAMLParser) cmdSNIPassthrough(arg any) (any, error) {
+	var routes []sniPassthroughRoute
+	if err := decodeArgs(arg, &routes); err != nil {
+		return nil, err
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("sni_passthrough: routes is required")
+	}
+
+	var chains []any
+	for i, route := range routes {
+		if len(route.ServerNames) == 0 {
+			return nil, fmt.Errorf("sni_passthrough[%d]: server_names is required", i)
+		}
+		filter, err := p.tcpProxyFilter(&route.tcpProxyArgs)
+		if err != nil {
+			return nil, fmt.Errorf("sni_passthrough[%d]: %w", i, err)
+		}
+		serverNames := make([]any, 0, len(route.ServerNames))
+		for _, name := range route.ServerNames {
+			serverNames = append(serverNames, name)
+		}
+		chains = append(chains, map[string]any{
+			"filter_chain_match": map[string]any{
+				"server_names":       serverNames,
+				"transport_protocol": "tls",
+			},
+			"filters": []any{filter},
+		})
+	}
+	return chains, nil
+}
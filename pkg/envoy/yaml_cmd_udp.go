@@ -0,0 +1,140 @@
+package envoy
+
+import (
+	"fmt"
+)
+
+type udpProxyArgs struct {
+	StatPrefix  string          `yaml:"stat_prefix"`
+	Cluster     string          `yaml:"cluster"`
+	IdleTimeout duration        `yaml:"idle_timeout"`
+	Routes      []udpProxyRoute `yaml:"routes"`
+}
+
+// udpProxyRoute routes datagrams to a cluster by their destination.
+type udpProxyRoute struct {
+	DestinationIP   string `yaml:"destination_ip"`
+	DestinationPort int    `yaml:"destination_port"`
+	Cluster         string `yaml:"cluster"`
+}
+
+// cmdUDPProxy generates the envoy.filters.udp_listener.udp_proxy listener
+// filter, it is used on listeners with an "udp://" address.
+//
+// Datagrams are routed by "routes" in order, the ones which don't match
+// any route are sent to "cluster". At least one of them must be specified.
+func (p *YAMLParser) cmdUDPProxy(arg any) (any, error) {
+	var args udpProxyArgs
+	if err := decodeArgs(arg, &args); err != nil {
+		return nil, err
+	}
+	if args.Cluster == "" && len(args.Routes) == 0 {
+		return nil, fmt.Errorf("udp_proxy: cluster or routes is required")
+	}
+	if args.StatPrefix == "" {
+		if args.Cluster == "" {
+			return nil, fmt.Errorf("udp_proxy: stat_prefix is required when cluster is not specified")
+		}
+		args.StatPrefix = args.Cluster
+	}
+
+	matcher := map[string]any{}
+	if len(args.Routes) > 0 {
+		var matchers []any
+		for i, route := range args.Routes {
+			m, err := route.build()
+			if err != nil {
+				return nil, fmt.Errorf("udp_proxy: routes[%d]: %w", i, err)
+			}
+			matchers = append(matchers, m)
+		}
+		matcher["matcher_list"] = map[string]any{
+			"matchers": matchers,
+		}
+	}
+	if args.Cluster != "" {
+		matcher["on_no_match"] = udpRouteAction(args.Cluster)
+	}
+
+	config := map[string]any{
+		"@type":       "type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.UdpProxyConfig",
+		"stat_prefix": args.StatPrefix,
+		"matcher":     matcher,
+	}
+	if args.IdleTimeout > 0 {
+		config["idle_timeout"] = args.IdleTimeout.String()
+	}
+	return map[string]any{
+		"listener_filters": []any{
+			map[string]any{
+				"name":         "envoy.filters.udp_listener.udp_proxy",
+				"typed_config": config,
+			},
+		},
+	}, nil
+}
+
+func (r *udpProxyRoute) build() (map[string]any, error) {
+	if r.Cluster == "" {
+		return nil, fmt.Errorf("cluster is required")
+	}
+	var predicates []any
+	if r.DestinationIP != "" {
+		predicates = append(predicates, udpSinglePredicate(
+			"envoy.matching.inputs.destination_ip",
+			"type.googleapis.com/envoy.extensions.matching.common_inputs.network.v3.DestinationIPInput",
+			r.DestinationIP))
+	}
+	if r.DestinationPort > 0 {
+		predicates = append(predicates, udpSinglePredicate(
+			"envoy.matching.inputs.destination_port",
+			"type.googleapis.com/envoy.extensions.matching.common_inputs.network.v3.DestinationPortInput",
+			fmt.Sprint(r.DestinationPort)))
+	}
+
+	var predicate any
+	switch len(predicates) {
+	case 0:
+		return nil, fmt.Errorf("destination_ip or destination_port is required")
+	case 1:
+		predicate = predicates[0]
+	default:
+		predicate = map[string]any{
+			"and_matcher": map[string]any{
+				"predicate": predicates,
+			},
+		}
+	}
+	return map[string]any{
+		"predicate": predicate,
+		"on_match":  udpRouteAction(r.Cluster),
+	}, nil
+}
+
+func udpSinglePredicate(inputName, inputType, value string) map[string]any {
+	return map[string]any{
+		"single_predicate": map[string]any{
+			"input": map[string]any{
+				"name": inputName,
+				"typed_config": map[string]any{
+					"@type": inputType,
+				},
+			},
+			"value_match": map[string]any{
+				"exact": value,
+			},
+		},
+	}
+}
+
+func udpRouteAction(cluster string) map[string]any {
+	return map[string]any{
+		"action": map[string]any{
+			"name": "route",
+			"typed_config": map[string]any{
+				"@type":   "type.googleapis.com/envoy.extensions.filters.udp.udp_proxy.v3.Route",
+				"cluster": cluster,
+			},
+		},
+	}
+}
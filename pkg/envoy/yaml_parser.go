@@ -3,8 +3,11 @@ package envoy
 import (
 	"bytes"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 	"unicode/utf8"
 
 	"github.com/jxskiss/gopkg/v2/easy"
@@ -14,6 +17,18 @@ import (
 
 type YAMLParser struct {
 	cfg *Configuration
+
+	// edsSeeds are the initial endpoints of EDS clusters, which are
+	// written to the endpoints files if the files don't exist.
+	edsSeeds map[string][]Endpoint
+
+	// useAdminCluster tells that the "envoy_admin" cluster is referenced
+	// by generated listeners, see cmdPrometheusListener.
+	useAdminCluster bool
+
+	// accessLogDirs are the directories of file access logs, which are
+	// created by Run before starting Envoy.
+	accessLogDirs []string
 }
 
 func (p *YAMLParser) solveCommands(path string, data any) (any, error) {
@@ -26,7 +41,14 @@ func (p *YAMLParser) solveCommands(path string, data any) (any, error) {
 	return data, nil
 }
 
-func (p *YAMLParser) solveCommandsInMap(path string, data map[string]any) (map[string]any, error) {
+// solveCommandsInMap solves commands in a map.
+//
+// Command results of map keys are merged into the map, nested maps are
+// merged recursively and slices are concatenated.
+// As a special case, if the map contains only one command key, the command
+// can return a non-map result, which replaces the map itself. This allows
+// commands to generate lists, e.g. '{"!@@ http_filters": [...]}'.
+func (p *YAMLParser) solveCommandsInMap(path string, data map[string]any) (any, error) {
 	var err error
 	for k, v := range data {
 		nextPath := getNextPath(path, k)
@@ -49,13 +71,22 @@ func (p *YAMLParser) solveCommandsInMap(path string, data map[string]any) (map[s
 		data[k] = cmdResult
 	}
 
-	newData := make(map[string]map[string]any)
-	for k, v := range data {
-		nextPath := getNextPath(path, k)
-		cmd, ok := p.isCommand(k)
-		if !ok {
-			continue
+	var cmdKeys []string
+	for k := range data {
+		if _, ok := p.isCommand(k); ok {
+			cmdKeys = append(cmdKeys, k)
 		}
+	}
+	sort.Strings(cmdKeys)
+
+	// Check the key count before command keys are deleted below,
+	// a non-map result is allowed only if the command is the only key.
+	singleKey := len(data) == 1
+	newData := make([]map[string]any, 0, len(cmdKeys))
+	for _, k := range cmdKeys {
+		v := data[k]
+		nextPath := getNextPath(path, k)
+		cmd, _ := p.isCommand(k)
 		cmdResult, err := p.runCommand(cmd, v)
 		if err != nil {
 			return nil, fmt.Errorf("%s: run command %s: %w", nextPath, cmd, err)
@@ -66,18 +97,25 @@ func (p *YAMLParser) solveCommandsInMap(path string, data map[string]any) (map[s
 		}
 		m, ok := cmdResult.(map[string]any)
 		if !ok {
+			if singleKey {
+				return p.solveCommands(nextPath, cmdResult)
+			}
 			return nil, fmt.Errorf("%s: command %s want map result, but got %v", path, cmd, cmdResult)
 		}
-		m, err = p.solveCommandsInMap(nextPath, m)
+		solved, err := p.solveCommandsInMap(nextPath, m)
 		if err != nil {
 			return nil, err
 		}
-		newData[k] = m
+		m, ok = solved.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: command %s want map result, but got %v", path, cmd, solved)
+		}
+		newData = append(newData, m)
 		delete(data, k)
 	}
 
 	for _, cmdResult := range newData {
-		easy.MergeMapsTo(data, cmdResult)
+		mergeMap(data, cmdResult)
 	}
 	return data, nil
 }
@@ -87,6 +125,10 @@ func (p *YAMLParser) solveCommandsInSlice(path string, slice []any) (any, error)
 		_, ok := a.([]any)
 		return ok
 	}
+	isMap := func(a any) bool {
+		_, ok := a.(map[string]any)
+		return ok
+	}
 
 	var err error
 	var i int
@@ -94,21 +136,28 @@ func (p *YAMLParser) solveCommandsInSlice(path string, slice []any) (any, error)
 		nextPath := getNextPath(path, fmt.Sprintf("[%d]", i))
 		val := slice[i]
 		cmd, ok := p.isCommand(val)
+		var cmdResult any
 		if !ok {
-			slice[i], err = p.solveCommands(nextPath, val)
+			cmdResult, err = p.solveCommands(nextPath, val)
+			if err != nil {
+				return nil, err
+			}
+			// A map is solved to be a slice only if it is a command
+			// which generates list, else keep it as is.
+			if !isMap(val) || !isSlice(cmdResult) {
+				slice[i] = cmdResult
+				i++
+				continue
+			}
+		} else {
+			cmdResult, err = p.runCommand(cmd, nil)
+			if err != nil {
+				return nil, fmt.Errorf("%s: run command %s: %w", nextPath, cmd, err)
+			}
+			cmdResult, err = p.solveCommands(nextPath, cmdResult)
 			if err != nil {
 				return nil, err
 			}
-			i++
-			continue
-		}
-		cmdResult, err := p.runCommand(cmd, nil)
-		if err != nil {
-			return nil, fmt.Errorf("%s: run command %s: %w", nextPath, cmd, err)
-		}
-		cmdResult, err = p.solveCommands(nextPath, cmdResult)
-		if err != nil {
-			return nil, err
 		}
 		if cmdResult == nil {
 			if len(slice) > i+1 {
@@ -125,15 +174,35 @@ func (p *YAMLParser) solveCommandsInSlice(path string, slice []any) (any, error)
 
 		// Copy cmdResult elements into slice.
 		s := cmdResult.([]any)
-		newSlice := easy.Copy(slice[:i], cap(slice)+len(s))
+		newSlice := easy.Copy(slice[:i], len(slice)+len(s))
 		newSlice = append(newSlice, s...)
-		newSlice = append(newSlice, s[i:]...)
+		newSlice = append(newSlice, slice[i+1:]...)
 		slice = newSlice
 		i += len(s)
 	}
 	return slice, nil
 }
 
+// mergeMap merges src into dst, nested maps are merged recursively,
+// slices are concatenated, other values in src overwrite the values in dst.
+func mergeMap(dst, src map[string]any) {
+	for k, srcVal := range src {
+		switch x := srcVal.(type) {
+		case map[string]any:
+			if dstMap, ok := dst[k].(map[string]any); ok {
+				mergeMap(dstMap, x)
+				continue
+			}
+		case []any:
+			if dstSlice, ok := dst[k].([]any); ok {
+				dst[k] = append(dstSlice, x...)
+				continue
+			}
+		}
+		dst[k] = srcVal
+	}
+}
+
 func (p *YAMLParser) executeTemplate(s string, data any) (string, error) {
 	var buf bytes.Buffer
 	tmpl, err := template.New("").Parse(s)
@@ -166,6 +235,45 @@ func (p *YAMLParser) parseYAML(s string, data ...any) (any, error) {
 	return dst, nil
 }
 
+// decodeArgs decodes a command argument into dst, which should be
+// a pointer to a struct with yaml tags.
+// Unknown fields are reported as errors, so that typos in the
+// configuration files don't get silently ignored.
+func decodeArgs(arg any, dst any) error {
+	if arg == nil {
+		return nil
+	}
+	b, err := yaml.Marshal(arg)
+	if err != nil {
+		return fmt.Errorf("cannot marshal args: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	err = dec.Decode(dst)
+	if err != nil {
+		return fmt.Errorf("invalid args: %w", err)
+	}
+	return nil
+}
+
+// duration is a duration argument of commands.
+// It accepts Go duration strings such as "1s", "500ms", "1m30s",
+// and renders in the protobuf JSON format which Envoy expects.
+type duration time.Duration
+
+func (d *duration) UnmarshalYAML(value *yaml.Node) error {
+	x, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", value.Value)
+	}
+	*d = duration(x)
+	return nil
+}
+
+func (d duration) String() string {
+	return strconv.FormatFloat(time.Duration(d).Seconds(), 'f', -1, 64) + "s"
+}
+
 func getNextPath(path, next string) string {
 	sep := "."
 	isSliceIndex := len(next) > 2 && next[0] == '[' && next[len(next)-1] == ']' && strutil.IsASCIIDigit(next[1:len(next)-1])
@@ -0,0 +1,215 @@
+package envoy
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testRouterFilter = `{
+  name: envoy.filters.http.router,
+  typed_config: {"@type": type.googleapis.com/envoy.extensions.filters.http.router.v3.Router}
+}`
+
+func mustParseYAML(t *testing.T, s string) any {
+	t.Helper()
+	p := &YAMLParser{}
+	x, err := p.parseYAML(s)
+	if err != nil {
+		t.Fatalf("parse yaml: %v", err)
+	}
+	return x
+}
+
+func TestMergeMap(t *testing.T) {
+	testCases := []struct {
+		name string
+		dst  string
+		src  string
+		want string
+	}{
+		{
+			name: "new keys",
+			dst:  `{a: 1}`,
+			src:  `{b: 2}`,
+			want: `{a: 1, b: 2}`,
+		},
+		{
+			name: "scalar overwritten",
+			dst:  `{a: 1, b: 1}`,
+			src:  `{b: 2}`,
+			want: `{a: 1, b: 2}`,
+		},
+		{
+			name: "nested maps merged",
+			dst:  `{a: {x: 1, y: {p: 1}}}`,
+			src:  `{a: {y: {q: 2}, z: 3}}`,
+			want: `{a: {x: 1, y: {p: 1, q: 2}, z: 3}}`,
+		},
+		{
+			name: "slices concatenated",
+			dst:  `{a: [1, 2], b: {c: [x]}}`,
+			src:  `{a: [3], b: {c: [y, z]}}`,
+			want: `{a: [1, 2, 3], b: {c: [x, y, z]}}`,
+		},
+		{
+			name: "type mismatch overwritten",
+			dst:  `{a: [1], b: {x: 1}}`,
+			src:  `{a: {x: 1}, b: [1]}`,
+			want: `{a: {x: 1}, b: [1]}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := mustParseYAML(t, tc.dst).(map[string]any)
+			src := mustParseYAML(t, tc.src).(map[string]any)
+			want := mustParseYAML(t, tc.want)
+			mergeMap(dst, src)
+			if !reflect.DeepEqual(dst, want) {
+				t.Errorf("mergeMap got %v, want %v", dst, want)
+			}
+		})
+	}
+}
+
+func TestSolveCommands(t *testing.T) {
+	testCases := []struct {
+		name  string
+		stats bool
+		input string
+		want  string
+	}{
+		{
+			name: "map command result merged",
+			input: `
+admin:
+  profile_path: /tmp/envoy.prof
+"!@@ envoy_admin": {}
+`,
+			want: `
+admin:
+  profile_path: /tmp/envoy.prof
+  address:
+    socket_address:
+      address: 127.0.0.1
+      port_value: 9000
+`,
+		},
+		{
+			name:  "slice in command result concatenated",
+			stats: true,
+			input: `
+stats_sinks:
+  - name: custom
+"!@@ envoy_stats": {}
+`,
+			want: `
+stats_sinks:
+  - name: custom
+  - name: envoy.stat_sinks.statsd
+    typed_config:
+      "@type": type.googleapis.com/envoy.config.metrics.v3.StatsdSink
+      address:
+        socket_address:
+          address: 127.0.0.1
+          port_value: 8125
+`,
+		},
+		{
+			name: "nil result removes map key",
+			input: `
+a: 1
+"!@@ envoy_stats": {}
+`,
+			want: `a: 1`,
+		},
+		{
+			name: "nil result removes slice element",
+			input: `
+- a
+- "!@@ sds_cluster"
+- b
+`,
+			want: `[a, b]`,
+		},
+		{
+			name: "single command map replaced by list",
+			input: `
+http_filters:
+  "!@@ http_filters": []
+`,
+			want: `http_filters: [` + testRouterFilter + `]`,
+		},
+		{
+			name: "list result spliced into slice",
+			input: `
+- a
+- "!@@ http_filters": []
+- b
+`,
+			want: `[a, ` + testRouterFilter + `, b]`,
+		},
+		{
+			name: "plain map in slice kept",
+			input: `
+- a
+- {x: [1, 2]}
+`,
+			want: `[a, {x: [1, 2]}]`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &Configuration{AdminPort: 9000}
+			if tc.stats {
+				cfg.Stats.Sinks = []*StatsSink{{Type: "statsd", Address: "127.0.0.1:8125"}}
+			}
+			p := &YAMLParser{cfg: cfg}
+			got, err := p.solveCommands("test", mustParseYAML(t, tc.input))
+			if err != nil {
+				t.Fatalf("solveCommands: %v", err)
+			}
+			want := mustParseYAML(t, tc.want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("solveCommands got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSolveCommandsNonMapResultWithOtherKeys(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{
+			name: "plain key",
+			input: `
+a: 1
+"!@@ http_filters": []
+`,
+		},
+		{
+			name: "command key with map result",
+			input: `
+"!@@ envoy_admin": {}
+"!@@ http_filters": []
+`,
+		},
+		{
+			name: "command key with nil result",
+			input: `
+"!@@ envoy_stats": {}
+"!@@ http_filters": []
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &YAMLParser{cfg: &Configuration{AdminPort: 9000}}
+			got, err := p.solveCommands("test", mustParseYAML(t, tc.input))
+			if err == nil {
+				t.Fatalf("want error for list result with other keys, got %v", got)
+			}
+		})
+	}
+}